@@ -0,0 +1,115 @@
+package sparse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrInvalidBlob is returned, as a *ParseError, when an @base64 directive read with Base64Blobs does not hold a key
+// and valid base64, or its data is not closed by ">>>".
+var ErrInvalidBlob = errors.New("sparse: invalid base64 blob")
+
+// blobDirective is the key of the fields read as BlobFields when Base64Blobs is set.
+const blobDirective = "@base64"
+
+// blobEnd ends the data of a blob written across lines.
+var blobEnd = []byte(">>>")
+
+// blobLineLen is the length of the lines of base64 an Encoder writes for a BlobField.
+const blobLineLen = 76
+
+// BlobField is a field holding binary data, read with Base64Blobs from an @base64 directive. Its data is written as
+// standard, padded base64. Where fields are read as Fields, as by BuildTree, Flatten, and Unmarshal, a BlobField is
+// read as a Field with its key and the base64 text of its data as its value.
+type BlobField struct {
+	Key  string
+	Data []byte
+}
+
+func (BlobField) piece()     {}
+func (BlobField) Kind() Kind { return KindField }
+
+// String returns the blob as a single @base64 directive.
+func (b BlobField) String() string {
+	return blobDirective + " " + escapeKey(b.Key) + " " + base64.StdEncoding.EncodeToString(b.Data)
+}
+func (b BlobField) GoString() string { return fmt.Sprintf("%T(%q: %d bytes)", b, b.Key, len(b.Data)) }
+
+// field returns b as a Field holding its data as standard, padded base64.
+func (b BlobField) field() Field { return Field{b.Key, base64.StdEncoding.EncodeToString(b.Data)} }
+
+// lines returns the blob as an @base64 directive, its data split across lines if it is long.
+func (b BlobField) lines() []string {
+	data := base64.StdEncoding.EncodeToString(b.Data)
+	if len(data) <= blobLineLen {
+		return []string{b.String()}
+	}
+	lines := []string{blobDirective + " " + escapeKey(b.Key) + " <<<"}
+	for len(data) > blobLineLen {
+		lines = append(lines, data[:blobLineLen])
+		data = data[blobLineLen:]
+	}
+	return append(lines, data, ">>>")
+}
+
+// readBlob returns the parser that follows an @base64 directive with the given value, ended by err, and the BlobField
+// it holds. If the value ends in "<<<", the blob's data is read from the lines following it by readBlobData.
+func (p *Parser) readBlob(value string, next parser, err error) (parser, Piece, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 || fields[1] == "<<<" && (len(fields) > 2 || err != nil) {
+		err := &ParseError{Pos: p.start, Err: ErrInvalidBlob}
+		return errReader{err}, nil, err
+	} else if fields[1] == "<<<" {
+		return p.readBlobData(fields[0], next), nil, nil
+	}
+
+	next, piece, derr := p.decodeBlob(fields[0], strings.Join(fields[1:], ""), next)
+	if derr != nil {
+		return next, piece, derr
+	}
+	return next, piece, err
+}
+
+// readBlobData returns a parser that reads the data of a blob up to the ">>>" ending it and returns the blob.
+// Whitespace within the data is ignored.
+func (p *Parser) readBlobData(key string, next parser) parser {
+	var read parser
+	read = readFn(func(r Reader) (parser, Piece, error) {
+		c, _, err := p.readRune(r)
+		for err == nil {
+			if !p.space(c) {
+				p.buf.WriteRune(c)
+			}
+			if data := p.buf.Bytes(); bytes.HasSuffix(data, blobEnd) {
+				s := string(data[:len(data)-len(blobEnd)])
+				p.buf.Reset()
+				return p.decodeBlob(key, s, next)
+			}
+			c, _, err = p.readRune(r)
+		}
+
+		if err == ErrWouldBlock {
+			return read, nil, err
+		}
+		p.buf.Reset()
+		if err == io.EOF {
+			err = &ParseError{Pos: p.start, Err: ErrInvalidBlob}
+		}
+		return errReader{err}, nil, err
+	})
+	return read
+}
+
+// decodeBlob returns next and the BlobField holding the base64 data.
+func (p *Parser) decodeBlob(key, data string, next parser) (parser, Piece, error) {
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		err := &ParseError{Pos: p.start, Err: ErrInvalidBlob}
+		return errReader{err}, nil, err
+	}
+	return next, BlobField{Key: key, Data: b}, nil
+}
@@ -0,0 +1,77 @@
+package sparse_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nilium/sparse"
+	"github.com/nilium/sparse/sparsetest"
+)
+
+const blobs = "icon {\n\t@base64 data AAEC\n\t@base64 data <<<\n\tAwQF\n\t>>>\n}\n"
+
+func TestBlobs(t *testing.T) {
+	doc := parse(t, blobs, sparse.Base64Blobs(true))
+	sparsetest.AssertPieces(t, doc,
+		sparse.NodeEnter("icon"),
+		sparse.BlobField{Key: "data", Data: []byte{0, 1, 2}},
+		sparse.BlobField{Key: "data", Data: []byte{3, 4, 5}},
+		sparse.NodeLeave(1),
+	)
+	sparsetest.AssertRoundTrip(t, blobs, sparse.Base64Blobs(true))
+}
+
+func TestBlobHash(t *testing.T) {
+	doc := parse(t, blobs, sparse.Base64Blobs(true))
+	other := parse(t, "icon { @base64 data AAED; @base64 data AwQF }", sparse.Base64Blobs(true))
+	if doc.Hash() == other.Hash() {
+		t.Errorf("documents with different blobs hash equal")
+	}
+	same := parse(t, "icon { @base64 data AAEC; @base64 data AwQF }", sparse.Base64Blobs(true))
+	if doc.Hash() != same.Hash() {
+		t.Errorf("documents with the same blobs hash differently")
+	}
+	if text := parse(t, "icon { data AAEC; data AwQF }"); doc.Hash() == text.Hash() {
+		t.Errorf("blobs hash equal to fields holding their base64 text")
+	}
+}
+
+func TestBlobFlatten(t *testing.T) {
+	got := parse(t, blobs, sparse.Base64Blobs(true)).Flatten(".")
+	want := map[string]string{"icon.data[0]": "AAEC", "icon.data[1]": "AwQF"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Flatten = %v; want %v", got, want)
+	}
+}
+
+func TestBlobTree(t *testing.T) {
+	root, err := sparse.BuildTree(parse(t, blobs, sparse.Base64Blobs(true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sparse.Field{{Key: "data", Value: "AAEC"}, {Key: "data", Value: "AwQF"}}
+	if got := root.Children[0].Fields; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fields = %v; want %v", got, want)
+	}
+
+	m, err := sparse.UnmarshalMap([]byte(blobs), sparse.Base64Blobs(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	icon := map[string]interface{}{"data": []string{"AAEC", "AwQF"}}
+	if want := map[string]interface{}{"icon": icon}; !reflect.DeepEqual(m, want) {
+		t.Errorf("UnmarshalMap = %v; want %v", m, want)
+	}
+
+	var v struct {
+		Icon struct {
+			Data []string `sparse:"data"`
+		} `sparse:"icon"`
+	}
+	if err := sparse.Unmarshal([]byte(blobs), &v, sparse.Base64Blobs(true)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"AAEC", "AwQF"}; !reflect.DeepEqual(v.Icon.Data, want) {
+		t.Errorf("Unmarshal = %v; want %v", v.Icon.Data, want)
+	}
+}
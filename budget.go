@@ -0,0 +1,12 @@
+package sparse
+
+import "errors"
+
+// ErrWouldBlock is returned by Parser.Read when its ReadBudget is spent before a piece has been read. It is not a
+// syntax error: the parser's state is kept, and the next call to Read, given the same Reader, continues reading.
+var ErrWouldBlock = errors.New("sparse: read budget spent")
+
+// spent reports whether the runes read by the current call to Read have used up its ReadBudget.
+func (p *Parser) spent() bool {
+	return p.budget > 0 && p.runes >= p.budget
+}
@@ -1,5 +1,7 @@
 package sparse
 
+import "strings"
+
 type Configuration interface {
 	apply(*Parser)
 }
@@ -15,3 +17,361 @@ func (b TrimWhitespace) apply(p *Parser) { p.keepTrailingWhitespace = !bool(b) }
 type CompressWhitespace bool
 
 func (b CompressWhitespace) apply(p *Parser) { p.keepSeqWhitespace = !bool(b) }
+
+// TrimLeadingWhitespace causes leading whitespace to be trimmed from values. Unescaped whitespace between a key and
+// its value is always skipped, so this only affects whitespace that would otherwise begin a value: escaped whitespace,
+// such as "\ " or "\t", and the line ending and indentation following a backslash that continues a value onto its
+// next line. Unlike trailing whitespace, leading whitespace is trimmed even if it is escaped.
+type TrimLeadingWhitespace bool
+
+func (b TrimLeadingWhitespace) apply(p *Parser) { p.trimLeading = bool(b) }
+
+// UncompressedKeys lists the keys of fields whose values keep runs of whitespace, as if CompressWhitespace were not
+// set, while other values are still compressed.
+type UncompressedKeys []string
+
+func (keys UncompressedKeys) apply(p *Parser) {
+	if p.uncompressed == nil {
+		p.uncompressed = make(map[string]bool, len(keys))
+	}
+	for _, key := range keys {
+		p.uncompressed[key] = true
+	}
+}
+
+// LiteralHashKeys lists the keys of fields whose values never begin a comment at a '#', so that values such as URLs
+// with fragments and hex colors can be written without escaping, as in "url http://host/path#frag". A '#' elsewhere,
+// including in the values of other fields, still begins a comment.
+type LiteralHashKeys []string
+
+func (keys LiteralHashKeys) apply(p *Parser) {
+	if p.literalHash == nil {
+		p.literalHash = make(map[string]bool, len(keys))
+	}
+	for _, key := range keys {
+		p.literalHash[key] = true
+	}
+}
+
+// ContinuationJoin controls how the lines of a key or value continued by a backslash at the end of a line are joined.
+type ContinuationJoin int
+
+const (
+	// JoinNewline keeps a newline between continued lines. This is the default.
+	JoinNewline ContinuationJoin = iota
+	// JoinSpace replaces the newline between continued lines with a single space.
+	JoinSpace
+	// JoinNone removes the newline between continued lines.
+	JoinNone
+)
+
+func (j ContinuationJoin) apply(p *Parser) { p.join = j }
+
+// PreserveContinuationNewlines controls whether the newline between lines continued by a backslash is kept, as it is
+// by default, or dropped so that the lines are joined directly. It is equivalent to ContinuationJoin(JoinNewline) if
+// set and ContinuationJoin(JoinNone) if not.
+type PreserveContinuationNewlines bool
+
+func (b PreserveContinuationNewlines) apply(p *Parser) {
+	if b {
+		p.join = JoinNewline
+	} else {
+		p.join = JoinNone
+	}
+}
+
+// TrimNodeNames applies the same trailing whitespace trimming used for values to the names of nodes.
+type TrimNodeNames bool
+
+func (b TrimNodeNames) apply(p *Parser) { p.trimNodeNames = bool(b) }
+
+// DocComments causes comments to be read as DocComment pieces. It has no effect unless ReadComments is also set.
+type DocComments bool
+
+func (b DocComments) apply(p *Parser) { p.docComments = bool(b) }
+
+// NegationPrefix causes a '!' at the start of a key to mark its field as negated, rather than being read as a field
+// with an empty key. Fields are read as FieldEx pieces when NegationPrefix is set.
+type NegationPrefix bool
+
+func (b NegationPrefix) apply(p *Parser) { p.negationPrefix = bool(b) }
+
+// OnNodeComplete is called by the Parser with each node, as a tree, once it has been left. Nodes within the node are
+// complete and will have already been passed to the callback. Any error returned by the callback is returned by Read
+// and ends the parse.
+type OnNodeComplete func(*Node) error
+
+func (fn OnNodeComplete) apply(p *Parser) { p.onNodeComplete = fn }
+
+// OnDepthChange is called by the Parser each time it enters or leaves a node, with its depth before and after. It is
+// called as the brace or indentation changing the depth is read, which may be before the piece entering or leaving
+// the node is returned if comments are being merged. The implicit root read with WrapRoot does not change the depth.
+type OnDepthChange func(oldDepth, newDepth int)
+
+func (fn OnDepthChange) apply(p *Parser) { p.onDepthChange = fn }
+
+// SpaceFunc reports whether a rune is whitespace. It is used both to find the ends of keys and to compress and trim
+// whitespace in keys and values. Line endings are always treated as whitespace. If no SpaceFunc is given,
+// unicode.IsSpace is used.
+type SpaceFunc func(rune) bool
+
+func (fn SpaceFunc) apply(p *Parser) { p.isSpace, p.customSpace = fn, fn != nil }
+
+// ASCIISpace reports whether c is an ASCII whitespace character: a space, tab, newline, vertical tab, form feed, or
+// carriage return. It may be used as a SpaceFunc.
+func ASCIISpace(c rune) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+// Defines enables the @if and @endif directives. A section beginning with an "@if NAME" field and ending with an
+// "@endif" field in the same node is skipped, along with the directives themselves, unless NAME is set in Defines.
+// Sections may be nested. Directives always end at the end of their line. An @endif with no matching @if, or an @if
+// left unmatched at the end of input, is returned as a *ParseError.
+type Defines map[string]bool
+
+func (m Defines) apply(p *Parser) { p.defines = m }
+
+// OnDirective is called with the name, without its '@', and the value of each field keyed by an '@' and a name that
+// the parser does not handle itself, such as @if and @endif when Defines is set. The directive is read as handled, and
+// no piece is read for it, unless the function returns an error, which stops the parser and is returned as a
+// *ParseError. As with other directives, the field ends at the end of its line, and it is skipped without calling the
+// function if it is in a section skipped by @if. Without OnDirective, such fields are read as ordinary fields.
+type OnDirective func(name, args string) error
+
+func (fn OnDirective) apply(p *Parser) { p.onDirective = fn }
+
+// NamedLeaves causes the parser to read NamedNodeLeave pieces, carrying the name of the node left, in place of
+// NodeLeave.
+type NamedLeaves bool
+
+func (b NamedLeaves) apply(p *Parser) { p.namedLeaves = bool(b) }
+
+// WrapRoot causes the parser to enclose its input in an implicit root node, reading a NodeEnter with an empty name
+// before anything else and a NodeLeave of depth 0 at the end of input. The root does not count towards the depth of
+// the nodes it contains and is not passed to OnNodeComplete.
+type WrapRoot bool
+
+func (b WrapRoot) apply(p *Parser) { p.wrapRoot = bool(b) }
+
+// KeepTerminators causes the parser to record whether a field was ended by a '!' or ';', so that it can be encoded
+// with the same terminator. Fields are read as FieldEx pieces when KeepTerminators is set.
+type KeepTerminators bool
+
+func (b KeepTerminators) apply(p *Parser) { p.keepTerminators = bool(b) }
+
+// RuneFilter is called with each rune read by the parser before it is otherwise interpreted, including before escapes
+// are decoded and whitespace is compressed. The rune returned by the filter is used in place of the rune read, unless
+// the filter returns false, in which case the rune is dropped. Because filtering precedes escape decoding, a dropped
+// rune following a backslash does not end the escape, and the next rune kept is escaped instead. Runes are filtered in
+// comments as well.
+type RuneFilter func(rune) (rune, bool)
+
+func (fn RuneFilter) apply(p *Parser) { p.filter = fn }
+
+// RichPieces causes the parser to read NodeEnterEx pieces, carrying the position of the node and any comment following
+// its opening brace, in place of NodeEnter.
+type RichPieces bool
+
+func (b RichPieces) apply(p *Parser) { p.richPieces = bool(b) }
+
+// PositionalNodeValues causes the contents of a node opened and closed on the same line, such as "color { 1 0 0 }", to
+// be read as a single field with an empty key, rather than as a field keyed by the first word of the line.
+type PositionalNodeValues bool
+
+func (b PositionalNodeValues) apply(p *Parser) { p.positionalNodeValues = bool(b) }
+
+// IndentStructure causes the parser to read the structure of its input from indentation rather than braces. A field
+// with no value is read as entering a node of the same name if the line following it is indented further, and each
+// node is left when a line is indented less than its contents. Each line must be indented by tabs or by spaces, and
+// the same rune must be used throughout the input. Fields always end at the end of their line, and braces entering or
+// leaving nodes are an error.
+type IndentStructure bool
+
+func (b IndentStructure) apply(p *Parser) { p.indentStructure = bool(b) }
+
+// Recover causes the parser to skip the rest of the line on which it encounters a syntax error, such as an unexpected
+// end of node or an unmatched directive, or the input up to the point set by RecoverTo, and continue reading, rather
+// than stopping at the error. Errors skipped are returned by Parser.Errors, and Parse returns them as a MultiError.
+// Recover has no effect if IndentStructure is set.
+type Recover bool
+
+func (b Recover) apply(p *Parser) { p.recover = bool(b) }
+
+// SingleDocument causes the parser to return ErrTrailingContent if anything other than whitespace and comments follows
+// the first top-level node to be left, so that each input holds only a single definition.
+type SingleDocument bool
+
+func (b SingleDocument) apply(p *Parser) { p.singleDocument = bool(b) }
+
+// AssignmentOps lists runes that may be written between a key and its value, as in "key = value" or "key: value". The
+// first unescaped operator following a key, with or without whitespace around it, ends the key and is discarded.
+// Operators elsewhere in a value are kept.
+type AssignmentOps []rune
+
+func (ops AssignmentOps) apply(p *Parser) { p.assignOps = ops }
+
+// MergeComments causes comments on consecutive lines, each on a line of its own, to be read as a single comment with
+// the text of each line separated by newlines. A blank line or any other piece between comments ends the comment.
+type MergeComments bool
+
+func (b MergeComments) apply(p *Parser) { p.mergeComments = bool(b) }
+
+// RecoverErrors causes the parser to recover from syntax errors as it does with Recover, but to read each error as an
+// ErrorPiece in place of the line it skips, rather than collecting it to be returned by Parser.Errors.
+type RecoverErrors bool
+
+func (b RecoverErrors) apply(p *Parser) {
+	p.errorPieces = bool(b)
+	p.recover = p.recover || p.errorPieces
+}
+
+// ReadBudget limits the number of runes each call to Parser.Read may read from its Reader. If the budget is spent
+// before a piece has been read, Read returns ErrWouldBlock, and the next call to Read continues from where it stopped.
+// A budget of zero or less is unlimited.
+type ReadBudget int
+
+func (n ReadBudget) apply(p *Parser) { p.budget = int(n) }
+
+// KeyWords sets the number of whitespace-separated words on a line read as a field's key, so that with KeyWords(2),
+// "depth test lte" is read as the key "depth test" and the value "lte". Words are separated in the key by the
+// whitespace between them, compressed as whitespace in values is. A key ends early, with fewer words, wherever a key
+// otherwise would, such as at the end of its line. Directives are not affected.
+type KeyWords int
+
+func (n KeyWords) apply(p *Parser) { p.keyWords = int(n) }
+
+// ValueTerminators replaces the set of runes that end a value, which is '\n', ';', and '#' by default, so that a
+// dialect may, for example, also end values at ','. A line ending always ends a value, whether or not it is listed. A
+// value ended by '#' is followed by a comment, and the closing brace of a node ends a value as usual. Escaped
+// terminators are kept in the value.
+//
+// Given to an Encoder, ValueTerminators causes the runes listed to be escaped in values, so that they are read back
+// by a Parser with the same ValueTerminators.
+type ValueTerminators []rune
+
+func (terms ValueTerminators) apply(p *Parser) { p.valueTerms = append([]rune{'\n'}, terms...) }
+
+func (terms ValueTerminators) applyEncoder(e *Encoder) {
+	escapes := append([]string(nil), valueEscapes...)
+	for _, c := range terms {
+		switch c {
+		case '\\', '\n', ';', '#':
+			// Already escaped, or continues the value if escaped.
+		default:
+			escapes = append(escapes, string(c), `\`+string(c))
+		}
+	}
+	e.values = strings.NewReplacer(escapes...)
+}
+
+// QuotedNames causes a key beginning with '"' to be read up to the next unescaped '"', so that node names holding
+// spaces may be written as "my material" { ... } without escaping each space. The quoted text is read verbatim, apart
+// from a backslash escaping a '"' or backslash, and is neither trimmed nor compressed. A quoted key may also key a
+// field. It is an error for the input to end before the closing quote.
+//
+// Given to an Encoder, QuotedNames causes the names of nodes holding whitespace, or beginning with '"', to be quoted.
+type QuotedNames bool
+
+func (b QuotedNames) apply(p *Parser) { p.quotedNames = bool(b) }
+
+func (b QuotedNames) applyEncoder(e *Encoder) { e.quote = bool(b) }
+
+// MaxPieces limits the number of pieces the parser reads, returning ErrTooManyPieces in place of the first piece past
+// the limit, so that Parse does not accumulate an unbounded Document. The NodeEnter and NodeLeave of the implicit root
+// read with WrapRoot are not counted. A limit of zero or less is unlimited.
+type MaxPieces int
+
+func (n MaxPieces) apply(p *Parser) { p.maxPieces = int(n) }
+
+// RejectEmptyKeys causes the parser to return ErrEmptyKey in place of any field with an empty key, such as one read
+// from a line beginning with ';'. The positional fields read with PositionalNodeValues are not rejected. If
+// Recover is set, the rest of the line holding the field is skipped.
+type RejectEmptyKeys bool
+
+func (b RejectEmptyKeys) apply(p *Parser) { p.rejectEmptyKeys = bool(b) }
+
+// ParagraphValues causes values to continue across line endings until a blank line, holding only whitespace, so that
+// prose may be written in a value without escaping each line ending. Line endings within a value are kept as newlines,
+// and, unless CompressWhitespace is disabled, whitespace around them is compressed to the newline. A ';',
+// '#', or closing brace still ends a value, and an escaped line ending is joined as set by ContinuationJoin. It has no
+// effect if IndentStructure is set.
+type ParagraphValues bool
+
+func (b ParagraphValues) apply(p *Parser) { p.paragraphValues = bool(b) }
+
+// TabStop causes each tab in a value to be expanded to the spaces needed to reach the next multiple of the tab stop,
+// counting columns from the start of the tab's line in the input, so that values aligned with tabs keep their
+// alignment. Escaped tabs are kept as-is. Tabs are expanded after runs of whitespace are compressed, so a tab beginning
+// a run is still expanded in full. A tab stop of zero or less leaves tabs untouched.
+type TabStop int
+
+func (n TabStop) apply(p *Parser) { p.tabStop = int(n) }
+
+// MaxKeyLen limits the length of keys and node names, in bytes, returning ErrKeyTooLong and ending the parse once a
+// key grows past the limit, so that input holding an enormous key does not grow the parser's buffer without bound. A
+// limit of zero or less is unlimited.
+type MaxKeyLen int
+
+func (n MaxKeyLen) apply(p *Parser) { p.maxKeyLen = int(n) }
+
+// Base64Blobs causes fields keyed "@base64" to be read as BlobField pieces holding binary data. The field's value holds
+// the blob's key followed by its data as base64, as in "@base64 icon aGVsbG8=", or by "<<<", in which case the data is
+// read from the lines that follow, up to a closing ">>>". Whitespace within the data is ignored. ErrInvalidBlob is
+// returned if the key or data is missing or the data is not valid base64.
+type Base64Blobs bool
+
+func (b Base64Blobs) apply(p *Parser) { p.base64Blobs = bool(b) }
+
+// RecoverTo sets the point from which the parser resumes reading after a syntax error, when Recover or RecoverErrors is
+// set. Resuming at the end of a node avoids the errors that would otherwise follow a single misplaced brace.
+type RecoverTo int
+
+const (
+	// RecoverToLine resumes at the start of the line following the error. This is the default.
+	RecoverToLine RecoverTo = iota
+	// RecoverToBlankLine resumes after the first blank line following the error.
+	RecoverToBlankLine
+	// RecoverToNode resumes at the '}' leaving the node the error occurred in, discarding the rest of its contents. If
+	// the error rejected a node being entered, the parser instead resumes after the '}' leaving that node, discarding
+	// only its contents. At the top level, the parser resumes at the start of the next line that isn't within a node
+	// entered after the error.
+	RecoverToNode
+)
+
+func (t RecoverTo) apply(p *Parser) { p.recoverTo = t }
+
+// NormalizeLineEndings causes the parser to read each "\r\n" and each lone '\r', as used by classic Mac OS, as a single
+// '\n', so that input with any style of line ending is read as the same pieces. Without it, a '\r' is only whitespace,
+// and the lines of input ending in lone '\r' runes are read as one. Positions count a line ending of either form as one
+// line, and their offsets still refer to the input as given.
+type NormalizeLineEndings bool
+
+func (b NormalizeLineEndings) apply(p *Parser) { p.normalizeLineEndings = bool(b) }
+
+// VerbatimBlocks causes a value beginning with "{{" to be read verbatim up to the "}}" closing it, as in
+// "shader {{ void main() { ... } }}", so that text holding braces, '#', and ';' may be embedded without escaping. The
+// value is everything between the braces, including any whitespace and newlines, with no escapes processed. Braces
+// within the block are counted, so only a "}}" following balanced braces closes it. It is an error for the input to end
+// before the block is closed.
+type VerbatimBlocks bool
+
+func (b VerbatimBlocks) apply(p *Parser) { p.verbatimBlocks = bool(b) }
+
+// FieldDepth causes the parser to read FieldEx pieces recording the depth of the node holding each field, so that
+// fields may be grouped by node without tracking the pieces entering and leaving nodes. A top-level field has a depth
+// of zero, as does a field in the implicit root read with WrapRoot.
+type FieldDepth bool
+
+func (b FieldDepth) apply(p *Parser) { p.fieldDepth = bool(b) }
+
+// NodesOnly causes the parser to read only the pieces entering and leaving nodes, along with any ErrorPiece read with
+// RecoverErrors, so that the outline of a document can be read without keeping its fields and comments. Fields and
+// comments are still read, so that braces within them are handled as usual and any syntax errors they hold are still
+// returned, but are never returned by Read.
+type NodesOnly bool
+
+func (b NodesOnly) apply(p *Parser) { p.nodesOnly = bool(b) }
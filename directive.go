@@ -0,0 +1,68 @@
+package sparse
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrUnmatchedEndif = errors.New("sparse: @endif without matching @if")
+	ErrMissingEndif   = errors.New("sparse: @if without matching @endif")
+	ErrSectionDepth   = errors.New("sparse: @endif in a different node than its @if")
+)
+
+// section is a conditional section opened by an @if directive.
+type section struct {
+	pos   Position // position of the @if
+	depth int      // depth of the node the section was opened in
+	skip  bool     // whether pieces in the section are skipped
+}
+
+// isDirective reports whether key, the current key, names a directive handled by the parser, either natively or by
+// OnDirective. A key beginning with an escaped '@', as in "\@if", is never a directive.
+func (p *Parser) isDirective(key string) bool {
+	return (p.defines != nil || p.onDirective != nil) && strings.HasPrefix(key, "@") && !p.keyEscaped
+}
+
+// endsAtLine reports whether a field with the given key ends at the end of its line, rather than reading its value
+// from the next line when none follows the key.
+func (p *Parser) endsAtLine(key string) bool {
+	return p.indentStructure || p.isDirective(key)
+}
+
+// preprocess handles the @if and @endif directives permitted by Defines, and passes other directives to OnDirective.
+// It returns nil if the piece is a directive or is skipped by a conditional section.
+func (p *Parser) preprocess(piece Piece) (Piece, error) {
+	skip := len(p.sections) > 0 && p.sections[len(p.sections)-1].skip
+	if f, ok := fieldOf(piece); ok && p.isDirective(f.Key) {
+		switch {
+		case p.defines != nil && f.Key == "@if":
+			p.sections = append(p.sections, section{
+				pos:   p.start,
+				depth: p.depth,
+				skip:  skip || !p.defines[f.Value],
+			})
+			return nil, nil
+		case p.defines != nil && f.Key == "@endif":
+			if len(p.sections) == 0 {
+				return nil, &ParseError{Pos: p.start, Err: ErrUnmatchedEndif}
+			} else if p.sections[len(p.sections)-1].depth != p.depth {
+				return nil, &ParseError{Pos: p.start, Err: ErrSectionDepth}
+			}
+			p.sections = p.sections[:len(p.sections)-1]
+			return nil, nil
+		case p.onDirective != nil:
+			if skip {
+				return nil, nil
+			} else if err := p.onDirective(f.Key[1:], f.Value); err != nil {
+				return nil, &ParseError{Pos: p.start, Err: err}
+			}
+			return nil, nil
+		}
+	}
+
+	if skip {
+		return nil, nil
+	}
+	return piece, nil
+}
@@ -0,0 +1,74 @@
+package sparse
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Dump writes pieces to w as an indented tree for debugging. Unlike an Encoder, Dump's output is meant to be read by
+// people, and is not a document that can be parsed. Each node is written as its name in brackets with its contents
+// indented beneath it, each field as key=value, or as its key alone if it has no value, and each line of a comment
+// prefixed by "#". Keys, values, and names are quoted if they are empty or hold whitespace, '=', or runes that are not
+// printable. Errors writing to w are ignored.
+func Dump(w io.Writer, pieces []Piece) {
+	depth := 0
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(w, "%s"+format+"\n", append([]interface{}{strings.Repeat("  ", depth)}, args...)...)
+	}
+
+	for _, piece := range pieces {
+		switch piece.Kind() {
+		case KindNodeEnter:
+			name, _ := enterName(piece)
+			line("[%s]", dumpString(name))
+			depth++
+		case KindNodeLeave:
+			if depth > 0 {
+				depth--
+			}
+		case KindField:
+			if b, ok := piece.(BlobField); ok {
+				line("%s=<%d bytes>", dumpString(b.Key), len(b.Data))
+				continue
+			}
+			f, _ := fieldOf(piece)
+			if f.Value == "" {
+				line("%s", dumpString(f.Key))
+				continue
+			}
+			line("%s=%s", dumpString(f.Key), dumpString(f.Value))
+		case KindComment:
+			var text string
+			switch c := piece.(type) {
+			case Comment:
+				text = string(c)
+			case DocComment:
+				text = c.Text
+			}
+			for _, l := range strings.Split(text, "\n") {
+				line("#%s", l)
+			}
+		case KindError:
+			if e, ok := piece.(ErrorPiece); ok {
+				line("! %v: %q", e.Err, e.Text)
+				continue
+			}
+			line("! %v", piece)
+		default:
+			line("%#v", piece)
+		}
+	}
+}
+
+// dumpString returns s, quoted if it would otherwise be hard to read in the output of Dump.
+func dumpString(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t=") {
+		return strconv.Quote(s)
+	}
+	if q := strconv.Quote(s); q[1:len(q)-1] != s {
+		return q
+	}
+	return s
+}
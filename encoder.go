@@ -1,24 +1,354 @@
 package sparse
 
-import "strings"
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
-// valueEscaper attempts to escape most, but not all, values.
-var valueEscaper = strings.NewReplacer(
+// EncoderOption configures an Encoder.
+type EncoderOption interface {
+	applyEncoder(*Encoder)
+}
+
+// Indent is the string an Encoder writes once per level of depth at the start of each line. It defaults to a single
+// tab.
+type Indent string
+
+func (s Indent) applyEncoder(e *Encoder) { e.indent = string(s) }
+
+// SortFields causes EncodeNode and EncodeTree to write the fields of each node sorted by key, so that equivalent trees
+// are written identically. Fields with the same key are written in their original order. It does not affect Encode.
+type SortFields bool
+
+func (b SortFields) applyEncoder(e *Encoder) { e.sortFields = bool(b) }
+
+// SortNodes causes EncodeNode and EncodeTree to write the children of each node sorted by name, keeping children with
+// the same name in their original order. It does not affect Encode.
+type SortNodes bool
+
+func (b SortNodes) applyEncoder(e *Encoder) { e.sortNodes = bool(b) }
+
+// Encoder writes pieces to an io.Writer as text that a Parser can read back.
+type Encoder struct {
+	w      io.Writer
+	indent string
+	depth  int
+	values *strings.Replacer // escapes values, including any ValueTerminators
+	quote  bool              // whether names are quoted, if QuotedNames is set
+
+	comment bool // whether the last piece written was a comment
+
+	sortFields bool
+	sortNodes  bool
+}
+
+func NewEncoder(w io.Writer, opts ...EncoderOption) *Encoder {
+	e := &Encoder{w: w, indent: "\t", values: valueEscaper}
+	for _, opt := range opts {
+		opt.applyEncoder(e)
+	}
+	return e
+}
+
+// Encode writes each piece on its own line, indented by the depth of the node it occurs in, so that the pieces written
+// are read back as the same pieces. Consecutive comments are separated by a blank line, so that they aren't merged if
+// read with MergeComments. It returns ErrUnexpectedNodeLeave if a piece leaves more nodes than have been entered, and
+// ErrEmptyKey if a field has a value but no key, such as one read with PositionalNodeValues, unless QuotedNames is set.
+func (e *Encoder) Encode(pieces ...Piece) error {
+	for _, piece := range pieces {
+		comment := e.comment
+		e.comment = piece.Kind() == KindComment
+		switch piece.Kind() {
+		case KindNodeEnter:
+			if err := e.writeLine(e.enter(piece)); err != nil {
+				return err
+			}
+			e.depth++
+		case KindNodeLeave:
+			if e.depth == 0 {
+				return ErrUnexpectedNodeLeave
+			}
+			e.depth--
+			if err := e.writeLine(piece.String()); err != nil {
+				return err
+			}
+		case KindComment:
+			if comment {
+				// Keep consecutive comments apart, so that they aren't read as one by MergeComments.
+				if _, err := io.WriteString(e.w, "\n"); err != nil {
+					return err
+				}
+			}
+			for _, line := range strings.Split(piece.String(), "\n") {
+				if err := e.writeLine(line); err != nil {
+					return err
+				}
+			}
+		case KindField:
+			if b, ok := piece.(BlobField); ok {
+				if b.Key == "" {
+					// A blob's key is never quoted, so an empty one isn't read back.
+					return ErrEmptyKey
+				}
+				for _, line := range b.lines() {
+					if err := e.writeLine(line); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if f, _ := fieldOf(piece); f.Key == "" && f.Value != "" && !e.quote {
+				// No unquoted key is read back as empty.
+				return ErrEmptyKey
+			}
+			if err := e.writeLine(e.field(piece)); err != nil {
+				return err
+			}
+		default:
+			if err := e.writeLine(piece.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// enter returns the text of the piece entering a node, with its name quoted if QuotedNames is set and the name holds
+// whitespace or begins with a quote.
+func (e *Encoder) enter(piece Piece) string {
+	name, _ := enterName(piece)
+	if !e.quote || !strings.ContainsAny(name, " \t") && !strings.HasPrefix(name, `"`) {
+		return piece.String()
+	}
+	s := `"` + quoteEscaper.Replace(name) + `" {`
+	if ex, ok := piece.(NodeEnterEx); ok && ex.Comment != "" {
+		s += " " + Comment(ex.Comment).String()
+	}
+	return s
+}
+
+// field returns the text of the field piece, with its value escaped by the encoder and an empty key quoted if
+// QuotedNames is set.
+func (e *Encoder) field(piece Piece) string {
+	switch f := piece.(type) {
+	case Field:
+		return f.encode(e.values, e.quote)
+	case FieldEx:
+		return f.encode(e.values, e.quote)
+	}
+	return piece.String()
+}
+
+// EncodeNode writes n as a node containing its fields followed by its children.
+func (e *Encoder) EncodeNode(n *Node) error {
+	if err := e.Encode(NodeEnter(n.Name)); err != nil {
+		return err
+	}
+	if err := e.EncodeTree(n); err != nil {
+		return err
+	}
+	return e.Encode(NodeLeave(e.depth))
+}
+
+// EncodeTree writes the fields and children of root without enclosing them in a node. It is the inverse of
+// BuildTree. root is not modified by SortFields or SortNodes.
+func (e *Encoder) EncodeTree(root *Node) error {
+	fields, children := root.Fields, root.Children
+	if e.sortFields {
+		fields = append([]Field(nil), fields...)
+		sort.SliceStable(fields, func(i, j int) bool { return fields[i].Key < fields[j].Key })
+	}
+	if e.sortNodes {
+		children = append([]*Node(nil), children...)
+		sort.SliceStable(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	}
+
+	for _, f := range root.unfold(fields) {
+		if err := e.Encode(f); err != nil {
+			return err
+		}
+	}
+	for _, child := range children {
+		if err := e.EncodeNode(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StripComments reads pieces from r, parsed with the given configurations, and writes them to w as an Encoder would,
+// without any comments, including those following the opening braces of nodes. Pieces are written as they are read, so
+// the document is never held in full. Escaped '#' runes within keys and values are written escaped, and so are not
+// taken for comments when the output is read back.
+func StripComments(r Reader, w io.Writer, configs ...Configuration) error {
+	p := NewParser(append(configs[:len(configs):len(configs)], ReadComments(false))...)
+	e := NewEncoder(w)
+	for {
+		piece, err := p.Read(r)
+		if err == ErrWouldBlock {
+			continue
+		} else if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if ex, ok := piece.(NodeEnterEx); ok {
+			piece = ex.NodeEnter
+		} else if piece.Kind() == KindComment {
+			continue
+		}
+		if err := e.Encode(piece); err != nil {
+			return err
+		}
+	}
+}
+
+// NewNormalizingReader returns a reader of the pieces read from r, parsed with the given configurations, written as an
+// Encoder would, so that a document can be normalized by copying from the reader. Pieces are read from r only as the
+// reader is read, so the document is never held in full. Once r is exhausted, the reader returns io.EOF, or the error
+// that Parse would return, including any syntax errors skipped if Recover is set.
+func NewNormalizingReader(r Reader, configs ...Configuration) io.Reader {
+	n := &normalizingReader{r: r, p: NewParser(configs...)}
+	n.e = NewEncoder(&n.buf)
+	return n
+}
+
+// normalizingReader is the reader returned by NewNormalizingReader.
+type normalizingReader struct {
+	r   Reader
+	p   *Parser
+	e   *Encoder
+	buf bytes.Buffer // text encoded but not yet read
+	err error
+}
+
+func (n *normalizingReader) Read(b []byte) (int, error) {
+	for n.buf.Len() == 0 && n.err == nil {
+		piece, err := n.p.Read(n.r)
+		if err == ErrWouldBlock {
+			continue
+		} else if err != nil {
+			if n.err = n.p.parseErr(err); n.err == nil {
+				n.err = io.EOF
+			}
+			break
+		}
+		n.err = n.e.Encode(piece)
+	}
+	if n.buf.Len() > 0 {
+		return n.buf.Read(b)
+	}
+	return 0, n.err
+}
+
+func (e *Encoder) writeLine(line string) error {
+	_, err := io.WriteString(e.w, strings.Repeat(e.indent, e.depth)+line+"\n")
+	return err
+}
+
+// StreamWriter writes a document to an io.Writer as it is built, one node, field, or comment at a time. Unlike an
+// Encoder, it does not permit nodes to be left unbalanced. Once a method returns an error, all further calls return
+// that error.
+type StreamWriter struct {
+	e   *Encoder
+	err error
+}
+
+// NewStreamWriter returns a StreamWriter that writes to w, encoding its pieces with the given options.
+func NewStreamWriter(w io.Writer, opts ...EncoderOption) *StreamWriter {
+	return &StreamWriter{e: NewEncoder(w, opts...)}
+}
+
+// Enter writes the start of a node with the given name.
+func (s *StreamWriter) Enter(name string) error { return s.encode(NodeEnter(name)) }
+
+// Leave writes the end of the node most recently entered. It returns ErrUnexpectedNodeLeave if no node is open.
+func (s *StreamWriter) Leave() error {
+	if s.err == nil && s.e.depth == 0 {
+		s.err = ErrUnexpectedNodeLeave
+	}
+	return s.encode(NodeLeave(s.e.depth))
+}
+
+// Field writes a field with the given key and value.
+func (s *StreamWriter) Field(key, value string) error { return s.encode(Field{key, value}) }
+
+// Flag writes a field with the given key and no value.
+func (s *StreamWriter) Flag(key string) error { return s.encode(Field{key, ""}) }
+
+// Comment writes a comment, with each line of text written as its own comment line.
+func (s *StreamWriter) Comment(text string) error { return s.encode(Comment(text)) }
+
+// Close checks that every node entered has been left, returning ErrUnclosedNode if not. It does not close the
+// underlying io.Writer.
+func (s *StreamWriter) Close() error {
+	if s.err == nil && s.e.depth > 0 {
+		s.err = ErrUnclosedNode
+	}
+	return s.err
+}
+
+func (s *StreamWriter) encode(piece Piece) error {
+	if s.err == nil {
+		s.err = s.e.Encode(piece)
+	}
+	return s.err
+}
+
+// valueEscapes lists the runes escaped in values and their escapes, as pairs of old and new strings.
+var valueEscapes = []string{
+	"\\", `\\`,
 	"#", `\#`,
 	";", `\;`,
+	"{", `\{`,
+	"}", `\}`,
 	"\b", `\b`,
 	"\f", `\f`,
 	"\n", "\\\n",
 	"\r", `\r`,
 	"\v", `\v`,
 	"\x00", `\0`,
-)
+}
+
+// valueEscaper attempts to escape most, but not all, values.
+var valueEscaper = strings.NewReplacer(valueEscapes...)
+
+// escapeKey escapes a key or node name for encoding. Whitespace outside of ASCII, which keyEscaper doesn't list, is
+// escaped by a backslash, as is a leading '@', so that the key isn't read as a directive.
+func escapeKey(key string) string {
+	if strings.HasPrefix(key, "@") {
+		return `\@` + escapeKey(key[1:])
+	}
+	var b strings.Builder
+	start := 0
+	for i, c := range key {
+		if c >= utf8.RuneSelf && unicode.IsSpace(c) {
+			b.WriteString(keyEscaper.Replace(key[start:i]))
+			b.WriteByte('\\')
+			b.WriteRune(c)
+			start = i + utf8.RuneLen(c)
+		}
+	}
+	if start == 0 {
+		return keyEscaper.Replace(key)
+	}
+	b.WriteString(keyEscaper.Replace(key[start:]))
+	return b.String()
+}
 
 // keyEscaper includes all escape codes from valueEscaper, with the addition of whitespace and the bang.
 var keyEscaper = strings.NewReplacer(
+	"\\", `\\`,
 	" ", `\ `,
 	"#", `\#`,
 	";", `\;`,
+	"{", `\{`,
+	"}", `\}`,
 	"\b", `\b`,
 	"\f", `\f`,
 	"\n", `\n`,
@@ -28,3 +358,36 @@ var keyEscaper = strings.NewReplacer(
 	"\x00", `\0`,
 	"!", `\!`,
 )
+
+// quoteEscaper escapes the names quoted by an Encoder with QuotedNames set.
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// escapeValue escapes a value for encoding with the given value escaper. Leading and trailing whitespace, and
+// whitespace following other whitespace, is escaped so that it is neither trimmed nor compressed when read.
+func escapeValue(s string, escaper *strings.Replacer) string {
+	if strings.IndexFunc(s, unicode.IsSpace) == -1 {
+		return escaper.Replace(s)
+	}
+
+	var b strings.Builder
+	end := len(strings.TrimRightFunc(s, unicode.IsSpace))
+	prevSpace := true // leading whitespace is escaped as though it followed whitespace
+	start := 0
+	for i, c := range s {
+		space := unicode.IsSpace(c)
+		if space && (prevSpace || i >= end) && c != '\r' && c != '\v' && c != '\f' {
+			b.WriteString(escaper.Replace(s[start:i]))
+			if c == '\n' {
+				// A line continuation would be trimmed or compressed like any other whitespace.
+				b.WriteString(`\n`)
+			} else {
+				b.WriteByte('\\')
+				b.WriteRune(c)
+			}
+			start = i + utf8.RuneLen(c)
+		}
+		prevSpace = space
+	}
+	b.WriteString(escaper.Replace(s[start:]))
+	return b.String()
+}
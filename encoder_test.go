@@ -0,0 +1,274 @@
+package sparse_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nilium/sparse"
+	"github.com/nilium/sparse/sparsetest"
+)
+
+// encode returns the pieces as written by an Encoder, failing t if an error occurs.
+func encode(t *testing.T, pieces ...sparse.Piece) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := sparse.NewEncoder(&buf).Encode(pieces...); err != nil {
+		t.Fatalf("Encode(%#v) = %v", pieces, err)
+	}
+	return buf.String()
+}
+
+func TestKeyBangs(t *testing.T) {
+	cases := []struct {
+		src  string
+		want sparse.Field
+	}{
+		{`foo\!bar value`, sparse.Field{Key: "foo!bar", Value: "value"}},
+		{`foo\! value`, sparse.Field{Key: "foo!", Value: "value"}},
+		{`\!foo value`, sparse.Field{Key: "!foo", Value: "value"}},
+		{`foo\!bar!`, sparse.Field{Key: "foo!bar"}},
+		{`a\!\!b c!d`, sparse.Field{Key: "a!!b", Value: "c!d"}},
+	}
+	for _, c := range cases {
+		sparsetest.AssertPieces(t, parse(t, c.src), c.want)
+		sparsetest.AssertPieces(t, parse(t, c.src, sparse.NegationPrefix(true)), sparse.FieldEx{Field: c.want})
+		sparsetest.AssertRoundTrip(t, c.src)
+		sparsetest.AssertRoundTrip(t, c.src, sparse.NegationPrefix(true))
+	}
+
+	if got, want := encode(t, sparse.Field{Key: "foo!bar", Value: "value"}), "foo\\!bar value\n"; got != want {
+		t.Errorf("encoded %q; want %q", got, want)
+	}
+}
+
+func TestBraceEscapes(t *testing.T) {
+	fields := []sparse.Field{
+		{Key: "a{b}", Value: "x{y}z"},
+		{Key: "{", Value: "{"},
+		{Key: "}", Value: "}"},
+		{Key: "k", Value: "{ not a node"},
+		{Key: "k", Value: "unmatched }"},
+	}
+	for _, f := range fields {
+		text := encode(t, f)
+		sparsetest.AssertPieces(t, parse(t, text), f)
+
+		// Escaped braces neither enter nor leave nodes, so the field is read the same within a node.
+		doc := sparse.Document{sparse.NodeEnter("n"), f, sparse.NodeLeave(1)}
+		sparsetest.AssertPieces(t, parse(t, encode(t, doc...)), doc...)
+	}
+
+	sparsetest.AssertPieces(t, parse(t, `a\{b\} x\{y\}z`), sparse.Field{Key: "a{b}", Value: "x{y}z"})
+	sparsetest.AssertPieces(t, parse(t, `k \{`), sparse.Field{Key: "k", Value: "{"})
+}
+
+func TestEmptyKeys(t *testing.T) {
+	for _, piece := range []sparse.Piece{
+		sparse.Field{Value: "v"},
+		sparse.FieldEx{Field: sparse.Field{Value: "v"}, Negated: true},
+		sparse.BlobField{Data: []byte("v")},
+	} {
+		var buf bytes.Buffer
+		if err := sparse.NewEncoder(&buf).Encode(piece); !errors.Is(err, sparse.ErrEmptyKey) {
+			t.Errorf("Encode(%#v) = %v; want %v", piece, err, sparse.ErrEmptyKey)
+		} else if buf.Len() != 0 {
+			t.Errorf("Encode(%#v) wrote %q; want nothing", piece, buf.String())
+		}
+	}
+	if _, err := (sparse.Field{Value: "v"}).MarshalText(); !errors.Is(err, sparse.ErrEmptyKey) {
+		t.Errorf("MarshalText() = %v; want %v", err, sparse.ErrEmptyKey)
+	}
+
+	// A field with neither a key nor a value is written as a lone terminator, which is read back as the same field.
+	sparsetest.AssertPieces(t, parse(t, encode(t, sparse.Field{})), sparse.Field{})
+
+	// The values of a node read with PositionalNodeValues have no key, and are only written with their keys quoted.
+	configs := []sparse.Configuration{sparse.PositionalNodeValues(true), sparse.QuotedNames(true)}
+	doc := parse(t, "color { 1 0 0 }", configs...)
+	if err := sparse.NewEncoder(new(bytes.Buffer)).Encode(doc...); !errors.Is(err, sparse.ErrEmptyKey) {
+		t.Errorf("Encode(%#v) = %v; want %v", doc, err, sparse.ErrEmptyKey)
+	}
+	var buf bytes.Buffer
+	if err := sparse.NewEncoder(&buf, sparse.QuotedNames(true)).Encode(doc...); err != nil {
+		t.Fatalf("Encode(%#v) = %v", doc, err)
+	}
+	sparsetest.AssertPieces(t, parse(t, buf.String(), configs...), doc...)
+}
+
+// TestRoundTrip checks that each document in testdata is read as the same pieces after being encoded.
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.sparse"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(files) == 0 {
+		t.Fatal("no documents in testdata")
+	}
+	configs := [][]sparse.Configuration{
+		nil,
+		{sparse.ReadComments(true)},
+		{sparse.ReadComments(true), sparse.CompressWhitespace(false)},
+		{sparse.NegationPrefix(true), sparse.KeepTerminators(true)},
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			for _, c := range configs {
+				sparsetest.AssertRoundTrip(t, string(data), c...)
+			}
+		})
+	}
+}
+
+func TestUnterminatedFlags(t *testing.T) {
+	configs := []sparse.Configuration{sparse.NegationPrefix(true), sparse.KeepTerminators(true)}
+	for _, src := range []string{"key", "key \\\n\nnext v", "n {\n\t!key\n}", "a!\nb;\nc"} {
+		sparsetest.AssertRoundTrip(t, src, configs...)
+	}
+
+	// Without KeepTerminators, a flag has no recorded terminator and is written with a '!'.
+	for _, c := range []sparse.Configuration{sparse.NegationPrefix(true), sparse.FieldDepth(true)} {
+		for _, src := range []string{"a!\nb c", "!a!\nb!", "n {\n\ta!\n}"} {
+			sparsetest.AssertRoundTrip(t, src, c)
+		}
+	}
+	if got, want := encode(t, parse(t, "!a!\nb!", sparse.NegationPrefix(true))...), "!a!\nb!\n"; got != want {
+		t.Errorf("encoded %q; want %q", got, want)
+	}
+
+	f := sparse.FieldEx{Field: sparse.Field{Key: "key"}, TerminatorKept: true}
+	text, err := f.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() = %v", err)
+	}
+	var got sparse.FieldEx
+	if err := got.UnmarshalText(text); err != nil {
+		t.Fatalf("UnmarshalText(%q) = %v", text, err)
+	}
+	sparsetest.AssertPieces(t, sparse.Document{got}, f)
+}
+
+func TestCommentRoundTrip(t *testing.T) {
+	texts := []string{
+		"", " leading", "  two leading", "\tindented", "trailing  ", "#", "# hashed", "#!", "{ } ; \\ ! @if \"",
+		"}", "a\nb", " a\n\n  b ", "ends in a return\r", "a\r\nb",
+	}
+	configs := []sparse.Configuration{sparse.ReadComments(true), sparse.MergeComments(true)}
+	for _, text := range texts {
+		for _, doc := range []sparse.Document{
+			{sparse.Comment(text)},
+			{sparse.NodeEnter("n"), sparse.Comment(text), sparse.NodeLeave(1)},
+			{sparse.Field{Key: "a", Value: "1"}, sparse.Comment(text), sparse.Comment(text)},
+		} {
+			encoded := encode(t, doc...)
+			sparsetest.AssertPieces(t, parse(t, encoded, configs...), doc...)
+
+			// Read without MergeComments, each line of the comment is a comment of its own.
+			var lines sparse.Document
+			for _, piece := range doc {
+				if c, ok := piece.(sparse.Comment); ok {
+					for _, line := range strings.Split(string(c), "\n") {
+						lines = append(lines, sparse.Comment(line))
+					}
+					continue
+				}
+				lines = append(lines, piece)
+			}
+			sparsetest.AssertPieces(t, parse(t, encoded, sparse.ReadComments(true)), lines...)
+		}
+
+		// A DocComment is written as a Comment, and is read back with the same text on a line of its own.
+		encoded := encode(t, sparse.DocComment{Text: text, Inline: true})
+		doc := parse(t, encoded, append(configs, sparse.DocComments(true))...)
+		if len(doc) != 1 {
+			t.Errorf("encoded DocComment %q read as %#v; want one DocComment", encoded, doc)
+		} else if c, ok := doc[0].(sparse.DocComment); !ok || c.Text != text || c.Inline {
+			t.Errorf("encoded DocComment %q read as %#v; want text %q, not inline", encoded, doc[0], text)
+		}
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	var buf bytes.Buffer
+	s := sparse.NewStreamWriter(&buf, sparse.QuotedNames(true))
+	for _, err := range []error{
+		s.Comment("first line\nsecond line"),
+		s.Enter("my node"),
+		s.Field("key", "a value"),
+		s.Flag("flag"),
+		s.Enter(`"quoted"`),
+		s.Field("k", "v"),
+		s.Leave(),
+		s.Enter("plain"),
+		s.Leave(),
+		s.Leave(),
+		s.Close(),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	const want = "#first line\n#second line\n\"my node\" {\n\tkey a value\n\tflag!\n\t\"\\\"quoted\\\"\" {\n\t\tk v\n" +
+		"\t}\n\tplain {\n\t}\n}\n"
+	if got := buf.String(); got != want {
+		t.Errorf("wrote %q; want %q", got, want)
+	}
+	sparsetest.AssertPieces(t, parse(t, buf.String(), sparse.QuotedNames(true), sparse.ReadComments(true)),
+		sparse.Comment("first line"),
+		sparse.Comment("second line"),
+		sparse.NodeEnter("my node"),
+		sparse.Field{Key: "key", Value: "a value"},
+		sparse.Field{Key: "flag"},
+		sparse.NodeEnter(`"quoted"`),
+		sparse.Field{Key: "k", Value: "v"},
+		sparse.NodeLeave(2),
+		sparse.NodeEnter("plain"),
+		sparse.NodeLeave(2),
+		sparse.NodeLeave(1),
+	)
+
+	// Without QuotedNames, whitespace in a name is escaped.
+	buf.Reset()
+	s = sparse.NewStreamWriter(&buf)
+	s.Enter("my node")
+	s.Leave()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	} else if got, want := buf.String(), "my\\ node {\n}\n"; got != want {
+		t.Errorf("wrote %q; want %q", got, want)
+	}
+
+	// An unbalanced Leave is an error returned by every call following it, and nothing more is written.
+	buf.Reset()
+	s = sparse.NewStreamWriter(&buf)
+	s.Field("a", "1")
+	if err := s.Leave(); err != sparse.ErrUnexpectedNodeLeave {
+		t.Errorf("Leave() = %v; want %v", err, sparse.ErrUnexpectedNodeLeave)
+	}
+	for _, err := range []error{s.Enter("n"), s.Field("b", "2"), s.Flag("c"), s.Comment("d"), s.Leave(), s.Close()} {
+		if err != sparse.ErrUnexpectedNodeLeave {
+			t.Errorf("call after Leave() = %v; want %v", err, sparse.ErrUnexpectedNodeLeave)
+		}
+	}
+	if got, want := buf.String(), "a 1\n"; got != want {
+		t.Errorf("wrote %q; want %q", got, want)
+	}
+
+	// Closing with nodes still open is an error, which is then returned by every call.
+	buf.Reset()
+	s = sparse.NewStreamWriter(&buf)
+	s.Enter("a")
+	s.Enter("b")
+	s.Leave()
+	if err := s.Close(); err != sparse.ErrUnclosedNode {
+		t.Errorf("Close() = %v; want %v", err, sparse.ErrUnclosedNode)
+	} else if err := s.Leave(); err != sparse.ErrUnclosedNode {
+		t.Errorf("Leave() after Close() = %v; want %v", err, sparse.ErrUnclosedNode)
+	}
+}
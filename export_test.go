@@ -0,0 +1,4 @@
+package sparse
+
+// BufCap returns the capacity of the buffer p reads keys and values into.
+func BufCap(p *Parser) int { return p.buf.Cap() }
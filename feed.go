@@ -0,0 +1,71 @@
+package sparse
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// feedReader is the Reader of input given to a Parser by Feed. It returns ErrWouldBlock, rather than io.EOF, once the
+// input fed to it has been read, until it is closed.
+type feedReader struct {
+	buf    []byte
+	off    int // offset of the first byte in buf not yet read
+	closed bool
+}
+
+func (r *feedReader) Read(b []byte) (int, error) {
+	if r.off == len(r.buf) {
+		return 0, r.empty()
+	}
+	n := copy(b, r.buf[r.off:])
+	r.off += n
+	return n, nil
+}
+
+func (r *feedReader) ReadRune() (rune, int, error) {
+	b := r.buf[r.off:]
+	if !utf8.FullRune(b) && !r.closed {
+		// Wait for the rest of a rune split across calls to Feed.
+		return 0, 0, ErrWouldBlock
+	} else if len(b) == 0 {
+		return 0, 0, r.empty()
+	}
+	c, n := utf8.DecodeRune(b)
+	r.off += n
+	return c, n, nil
+}
+
+// empty returns the error for a read made once all input fed to r has been read.
+func (r *feedReader) empty() error {
+	if r.closed {
+		return io.EOF
+	}
+	return ErrWouldBlock
+}
+
+// Feed appends b to the input read by Next. b is copied, so it may be reused once Feed returns. Input given to Feed
+// must not be mixed with input read by Read.
+func (p *Parser) Feed(b []byte) {
+	r := &p.feed
+	r.buf = append(r.buf[:copy(r.buf, r.buf[r.off:])], b...)
+	r.off = 0
+}
+
+// CloseFeed marks the end of the input given to Feed. Once it is called, Next reads whatever pieces remain and then
+// returns io.EOF.
+func (p *Parser) CloseFeed() { p.feed.closed = true }
+
+// Next reads the next piece from the input given to Feed. If that input runs out before a piece has been read, Next
+// returns false and a nil error: the parser's state, including that of any partly read key or value, is kept, and
+// the next call to Next continues reading once more input is fed to the parser. If a ReadBudget is set, Next also
+// returns false when the budget is spent, though input remains. Next returns io.EOF once CloseFeed has been called and
+// all input has been read.
+func (p *Parser) Next() (Piece, bool, error) {
+	piece, err := p.Read(&p.feed)
+	if err == ErrWouldBlock {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return piece, true, nil
+}
@@ -0,0 +1,121 @@
+package sparse_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nilium/sparse"
+	"github.com/nilium/sparse/sparsetest"
+)
+
+// feed gives each chunk to p in turn, reading the pieces available after each, and returns the pieces read before
+// CloseFeed is called. It fails t if Next returns an error before then.
+func feed(t *testing.T, p *sparse.Parser, chunks ...string) sparse.Document {
+	t.Helper()
+	var doc sparse.Document
+	for _, chunk := range chunks {
+		p.Feed([]byte(chunk))
+		for {
+			piece, ok, err := p.Next()
+			if err != nil {
+				t.Fatalf("Next() after feeding %q = %v", chunks, err)
+			} else if !ok {
+				break
+			}
+			doc = append(doc, piece)
+		}
+	}
+	return doc
+}
+
+// closeFeed calls CloseFeed and returns the pieces read from p up to the end of its input, and the error ending it,
+// if not io.EOF.
+func closeFeed(t *testing.T, p *sparse.Parser) (sparse.Document, error) {
+	t.Helper()
+	p.CloseFeed()
+	var doc sparse.Document
+	for {
+		piece, ok, err := p.Next()
+		if err == io.EOF {
+			return doc, nil
+		} else if err != nil {
+			return doc, err
+		} else if !ok {
+			t.Fatal("Next() = false after CloseFeed")
+		}
+		doc = append(doc, piece)
+	}
+}
+
+func TestFeed(t *testing.T) {
+	a := sparse.Field{Key: "a", Value: "1"}
+	cases := []struct {
+		chunks  []string
+		configs []sparse.Configuration
+		want    []sparse.Piece // read before CloseFeed
+		rest    []sparse.Piece // read after CloseFeed
+	}{
+		{[]string{"ke", "y value\n"}, nil, []sparse.Piece{sparse.Field{Key: "key", Value: "value"}}, nil},
+		{[]string{"key", " ", "value\na 1\n"}, nil, []sparse.Piece{sparse.Field{Key: "key", Value: "value"}, a}, nil},
+		{[]string{"key val", "ue\na 1\n"}, nil, []sparse.Piece{sparse.Field{Key: "key", Value: "value"}, a}, nil},
+		{[]string{"k \xc3", "\xa9\n"}, nil, []sparse.Piece{sparse.Field{Key: "k", Value: "é"}}, nil},
+		{[]string{"\xe2\x82", "\xac v\n"}, nil, []sparse.Piece{sparse.Field{Key: "€", Value: "v"}}, nil},
+		{[]string{"a 1 # com", "ment\n", "b 2\n"}, []sparse.Configuration{sparse.ReadComments(true)}, []sparse.Piece{
+			a, sparse.Comment(" comment"), sparse.Field{Key: "b", Value: "2"},
+		}, nil},
+		{[]string{"# com", "ment\na 1\n"}, nil, []sparse.Piece{a}, nil},
+		{[]string{"n {", " a 1 ", "}\n"}, nil, []sparse.Piece{sparse.NodeEnter("n"), a, sparse.NodeLeave(1)}, nil},
+
+		// A piece that may continue in later input is only read once the feed is closed.
+		{[]string{"a 1"}, nil, nil, []sparse.Piece{a}},
+		{[]string{"a 1\nflag"}, nil, []sparse.Piece{a}, []sparse.Piece{sparse.Field{Key: "flag"}}},
+		{[]string{"a 1 # cut"}, []sparse.Configuration{sparse.ReadComments(true)}, []sparse.Piece{a}, []sparse.Piece{
+			sparse.Comment(" cut"),
+		}},
+	}
+	for _, c := range cases {
+		p := sparse.NewParser(c.configs...)
+		sparsetest.AssertPieces(t, feed(t, p, c.chunks...), c.want...)
+		rest, err := closeFeed(t, p)
+		if err != nil {
+			t.Errorf("Next() after feeding %q = %v", c.chunks, err)
+		}
+		sparsetest.AssertPieces(t, rest, c.rest...)
+
+		// However the input is split, it is read as the same pieces as by Parse.
+		src := strings.Join(c.chunks, "")
+		want := parse(t, src, c.configs...)
+		for i := 0; i <= len(src); i++ {
+			p := sparse.NewParser(c.configs...)
+			doc := feed(t, p, src[:i], src[i:])
+			rest, err := closeFeed(t, p)
+			if err != nil {
+				t.Errorf("Next() after feeding %q, %q = %v", src[:i], src[i:], err)
+			}
+			sparsetest.AssertPieces(t, append(doc, rest...), want...)
+		}
+	}
+}
+
+func TestFeedErrorAtClose(t *testing.T) {
+	// An @if is only known to be unmatched once the end of input is reached.
+	p := sparse.NewParser(sparse.Defines{"x": true})
+	sparsetest.AssertPieces(t, feed(t, p, "@if x\n", "a 1\n"), sparse.Field{Key: "a", Value: "1"})
+	if piece, ok, err := p.Next(); piece != nil || ok || err != nil {
+		t.Errorf("Next() = %#v, %t, %v before CloseFeed; want nil, false, nil", piece, ok, err)
+	}
+	rest, err := closeFeed(t, p)
+	sparsetest.AssertPieces(t, rest)
+	if !errors.Is(err, sparse.ErrMissingEndif) {
+		t.Errorf("Next() after CloseFeed = %v; want %v", err, sparse.ErrMissingEndif)
+	}
+
+	// Feeding the rest of the section before closing the feed avoids the error.
+	p = sparse.NewParser(sparse.Defines{"x": true})
+	feed(t, p, "@if x\n", "a 1\n", "@end", "if\n")
+	if _, err := closeFeed(t, p); err != nil {
+		t.Errorf("Next() after CloseFeed = %v; want no error", err)
+	}
+}
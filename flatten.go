@@ -0,0 +1,46 @@
+package sparse
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Flatten returns the fields of d as a flat map from paths to values, for use with tools that only understand flat
+// key-value pairs. A field's path is the names of the nodes enclosing it followed by its key, joined by sep, so that
+// "stage { map a }" flattened with a sep of "." gives "stage.map" = "a". A path held by more than one field, whether
+// in one node or in several nodes of the same name, is given an index suffix for each, in order, as in "stage.map[0]"
+// and "stage.map[1]".
+//
+// An empty node name is held as an empty element of the path, so a field in an unnamed top-level node is held at sep
+// followed by its key. Fields with no value, such as flags, are held as the empty string, blobs as the base64 text of
+// their data, and negation is not represented. Comments, errors, and pieces leaving nodes that were never entered are
+// ignored.
+func (d Document) Flatten(sep string) map[string]string {
+	var names []string
+	var paths []string
+	var values []string
+	counts := make(map[string]int)
+	for _, piece := range d {
+		if name, ok := enterName(piece); ok {
+			names = append(names, name)
+		} else if _, ok := leaveDepth(piece); ok && len(names) > 0 {
+			names = names[:len(names)-1]
+		} else if f, ok := fieldOf(piece); ok {
+			path := strings.Join(append(names[:len(names):len(names)], f.Key), sep)
+			paths, values = append(paths, path), append(values, f.Value)
+			counts[path]++
+		}
+	}
+
+	flat := make(map[string]string, len(paths))
+	index := make(map[string]int)
+	for i, path := range paths {
+		if counts[path] > 1 {
+			n := index[path]
+			index[path]++
+			path += "[" + strconv.Itoa(n) + "]"
+		}
+		flat[path] = values[i]
+	}
+	return flat
+}
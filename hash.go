@@ -0,0 +1,42 @@
+package sparse
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// Hash returns a fingerprint of the fields and structure of d, suitable for use as a cache key. Comments, errors, and
+// the terminators of fields are ignored, so documents that differ only in formatting hash equal when read with the same
+// configurations. Node names, keys, values, negation, and the data of blobs are significant. Whitespace is compared as
+// it was read, since any left in a value by the parser, such as an escaped space, is part of the value.
+func (d Document) Hash() uint64 {
+	h := fnv.New64a()
+	var buf [binary.MaxVarintLen64]byte
+	write := func(tag byte, s string) {
+		h.Write([]byte{tag})
+		h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(s)))])
+		h.Write([]byte(s))
+	}
+
+	for _, piece := range d {
+		switch piece.Kind() {
+		case KindNodeEnter:
+			name, _ := enterName(piece)
+			write('{', name)
+		case KindNodeLeave:
+			write('}', "")
+		case KindField:
+			f, _ := fieldOf(piece)
+			tag := byte('=')
+			if fx, ok := piece.(FieldEx); ok && fx.Negated {
+				tag = '!'
+			} else if _, ok := piece.(BlobField); ok {
+				// A blob doesn't hash equal to a field holding the base64 text of its data.
+				tag = '@'
+			}
+			write(tag, f.Key)
+			write(tag, f.Value)
+		}
+	}
+	return h.Sum64()
+}
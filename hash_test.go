@@ -0,0 +1,55 @@
+package sparse_test
+
+import (
+	"testing"
+
+	"github.com/nilium/sparse"
+)
+
+func TestHash(t *testing.T) {
+	const src = "blend add\nnode {\n\tmap a.tga\n}\n"
+	equal := []string{
+		"blend    add\nnode {\n\tmap a.tga\n}\n",
+		"# comment\nblend add;node { map a.tga }",
+		"blend add # comment\nnode\n{\n    map   a.tga\n}",
+		"blend\tadd\nnode {\n\tmap a.tga;\n}\n",
+	}
+	differ := []string{
+		"blend add\nnode {\n\tmap b.tga\n}\n",
+		"blend add\nnode {\n\tmap a.tga\n}\nflag!",
+		"blend add\nother {\n\tmap a.tga\n}\n",
+		"blend add\nnode {\n}\nmap a.tga\n",
+		"blend add\\ \nnode {\n\tmap a.tga\n}\n",
+		"blend a\\ \\ dd\nnode {\n\tmap a.tga\n}\n",
+		"blend\\ add!\nnode {\n\tmap a.tga\n}\n",
+	}
+	want := parse(t, src).Hash()
+	for _, s := range equal {
+		if got := parse(t, s).Hash(); got != want {
+			t.Errorf("Hash(%q) = %x; want %x, as for %q", s, got, want, src)
+		}
+	}
+	for _, s := range differ {
+		if got := parse(t, s).Hash(); got == want {
+			t.Errorf("Hash(%q) = %x; want other than %x, as for %q", s, got, want, src)
+		}
+	}
+
+	pieces := []struct{ a, b sparse.Piece }{
+		{sparse.Field{Key: "p", Value: "x "}, sparse.Field{Key: "p", Value: "x"}},
+		{sparse.Field{Key: "p", Value: "a  b"}, sparse.Field{Key: "p", Value: "a b"}},
+		{sparse.Field{Key: "p", Value: "x"}, sparse.FieldEx{Field: sparse.Field{Key: "p", Value: "x"}, Negated: true}},
+	}
+	for _, c := range pieces {
+		if a, b := (sparse.Document{c.a}).Hash(), (sparse.Document{c.b}).Hash(); a == b {
+			t.Errorf("%#v and %#v hash equal", c.a, c.b)
+		}
+	}
+
+	// The terminators and depths recorded in FieldEx are formatting, and don't change the hash.
+	plain := sparse.Document{sparse.Field{Key: "p", Value: "x"}}.Hash()
+	ex := sparse.Document{sparse.FieldEx{Field: sparse.Field{Key: "p", Value: "x"}, Terminator: ';', Depth: 1}}.Hash()
+	if plain != ex {
+		t.Errorf("FieldEx with a terminator and depth hashes %x; want %x", ex, plain)
+	}
+}
@@ -0,0 +1,170 @@
+package sparse
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrMixedIndent        = errors.New("sparse: indentation mixes tabs and spaces")
+	ErrUnexpectedIndent   = errors.New("sparse: unexpected indentation")
+	ErrInconsistentIndent = errors.New("sparse: indentation does not match an enclosing node")
+	ErrIndentBrace        = errors.New("sparse: brace in indentation-structured input")
+)
+
+// indented is a piece read under IndentStructure, queued to be returned by Read. If enter or leave is set, the piece is
+// instead created when the entry is returned, so that the parser's depth is correct for each piece in the queue.
+type indented struct {
+	piece      Piece
+	start      Position
+	end        Position
+	keyEscaped bool // whether the key of the field in piece begins with an escaped rune
+	enter      bool // enter a node named by the field in piece
+	leave      bool // leave the current node
+}
+
+// markIndent records the indentation of the current line for the key starting at the last rune read, if the key is the
+// first thing on its line.
+func (p *Parser) markIndent() {
+	p.lineStart = !p.inline
+	if p.lineStart {
+		p.lineIndent = string(p.indent)
+	}
+}
+
+// readIndented reads the next piece from r, entering and leaving nodes according to the indentation of the lines that
+// fields begin on, as permitted by IndentStructure.
+func (p *Parser) readIndented(r Reader) (Piece, error) {
+	if p.indents == nil {
+		p.indents = []string{""}
+	}
+	for len(p.queue) == 0 {
+		if p.indentErr != nil {
+			return nil, p.indentErr
+		}
+
+		piece, err := p.readPiece(r)
+		if err == ErrWouldBlock {
+			return nil, err
+		} else if err != nil {
+			p.indentErr = err
+			if err == io.EOF {
+				p.resolveHeld(false)
+				for len(p.indents) > 1 {
+					p.indents = p.indents[:len(p.indents)-1]
+					p.queue = append(p.queue, indented{start: p.pos, end: p.pos, leave: true})
+				}
+			}
+			continue
+		}
+		if err := p.indentPiece(piece); err != nil {
+			p.resolveHeld(false)
+			p.indentErr = err
+		}
+	}
+
+	q := p.queue[0]
+	p.queue = p.queue[1:]
+	p.start, p.end, p.keyEscaped = q.start, q.end, q.keyEscaped
+	switch {
+	case q.enter:
+		f, _ := fieldOf(q.piece)
+		name := f.Key
+		if fx, ok := q.piece.(FieldEx); ok && fx.Negated {
+			name = "!" + name
+		}
+		if err := p.checkNodeName(name); err != nil {
+			p.queue, p.held, p.indentErr = nil, nil, err
+			return nil, err
+		}
+		p.setDepth(p.depth + 1)
+		if p.namedLeaves {
+			p.names = append(p.names, name)
+		}
+		if p.richPieces {
+			return NodeEnterEx{NodeEnter: NodeEnter(name), Pos: q.start}, nil
+		}
+		return NodeEnter(name), nil
+	case q.leave:
+		_, piece, err := p.leave()
+		return piece, err
+	}
+	if fx, ok := q.piece.(FieldEx); ok && p.fieldDepth {
+		// The field was read before the nodes queued ahead of it were entered or left.
+		fx.Depth = p.depth
+		return fx, nil
+	}
+	return q.piece, nil
+}
+
+// indentPiece queues piece, along with any nodes entered or left by the change in indentation preceding it.
+func (p *Parser) indentPiece(piece Piece) error {
+	q := indented{piece: piece, start: p.start, end: p.end, keyEscaped: p.keyEscaped}
+	switch piece.Kind() {
+	case KindNodeEnter, KindNodeLeave:
+		return &ParseError{Pos: p.start, Err: ErrIndentBrace}
+	case KindComment:
+		// Comments don't affect structure, so they stay behind a field that may yet name a node.
+		if len(p.held) > 0 {
+			p.held = append(p.held, q)
+		} else {
+			p.queue = append(p.queue, q)
+		}
+		return nil
+	}
+
+	f, ok := fieldOf(piece)
+	if !ok || !p.lineStart {
+		p.resolveHeld(false)
+		p.queue = append(p.queue, q)
+		return nil
+	}
+
+	indent := p.lineIndent
+	if strings.Contains(indent, " ") && strings.Contains(indent, "\t") {
+		return &ParseError{Pos: p.start, Err: ErrMixedIndent}
+	} else if indent != "" && p.indentChar == 0 {
+		p.indentChar = indent[0]
+	} else if indent != "" && indent[0] != p.indentChar {
+		return &ParseError{Pos: p.start, Err: ErrMixedIndent}
+	}
+
+	top := p.indents[len(p.indents)-1]
+	if len(indent) > len(top) {
+		if len(p.held) == 0 {
+			return &ParseError{Pos: p.start, Err: ErrUnexpectedIndent}
+		}
+		p.resolveHeld(true)
+		p.indents = append(p.indents, indent)
+	} else {
+		p.resolveHeld(false)
+		for len(indent) < len(top) {
+			p.indents = p.indents[:len(p.indents)-1]
+			p.queue = append(p.queue, indented{start: p.start, end: p.start, leave: true})
+			top = p.indents[len(p.indents)-1]
+		}
+		if len(indent) != len(top) {
+			return &ParseError{Pos: p.start, Err: ErrInconsistentIndent}
+		}
+	}
+
+	if f.Value == "" && !p.isDirective(f.Key) {
+		// The field may name a node if the lines following it are indented further.
+		p.held = append(p.held, q)
+	} else {
+		p.queue = append(p.queue, q)
+	}
+	return nil
+}
+
+// resolveHeld queues the field held back by indentPiece, and the comments that followed it, either as a field or as a
+// node entered if enter is set.
+func (p *Parser) resolveHeld(enter bool) {
+	if len(p.held) == 0 {
+		return
+	}
+	p.held[0].enter = enter
+	p.queue = append(p.queue, p.held...)
+	p.held = p.held[:0]
+}
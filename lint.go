@@ -0,0 +1,215 @@
+package sparse
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Diagnostic is a style issue found by Lint. Rule names the LintRules field that found it.
+type Diagnostic struct {
+	Pos      Position
+	Severity Severity
+	Rule     string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%v: %v: %s (%s)", d.Pos, d.Severity, d.Message, d.Rule)
+}
+
+// LintRules selects the checks made by Lint. The zero LintRules makes no checks.
+//
+// TrailingWhitespace reports unescaped whitespace at the end of a line. MixedIndent reports lines indented by both
+// tabs and spaces, or by a different rune than the first indented line. EmptyNodes reports nodes holding no fields or
+// nodes. DuplicateKeys reports fields whose key occurs earlier in the same node. Escapes reports escapes of runes that
+// need no escaping under the configuration given to Lint, so that an escape of '=' is only needed if '=' is one of its
+// AssignmentOps, for instance.
+type LintRules struct {
+	TrailingWhitespace bool
+	MixedIndent        bool
+	EmptyNodes         bool
+	DuplicateKeys      bool
+	Escapes            bool
+}
+
+// AllLintRules enables every check made by Lint.
+var AllLintRules = LintRules{
+	TrailingWhitespace: true,
+	MixedIndent:        true,
+	EmptyNodes:         true,
+	DuplicateKeys:      true,
+	Escapes:            true,
+}
+
+// Lint parses r with the given configuration and returns the style issues found in it, ordered by position. Issues do
+// not stop the parse. If r cannot be parsed, the issues found up to the error are returned with it.
+func Lint(r Reader, rules LintRules, configs ...Configuration) ([]Diagnostic, error) {
+	var text bytes.Buffer
+	doc, positions, err := ParseWithPositions(TeeReader(r, &text), configs...)
+
+	var diags []Diagnostic
+	if rules.EmptyNodes || rules.DuplicateKeys {
+		diags = lintPieces(diags, rules, doc, positions)
+	}
+	if rules.TrailingWhitespace || rules.MixedIndent || rules.Escapes {
+		diags = lintText(diags, rules, text.Bytes(), NewParser(configs...))
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Pos.Offset < diags[j].Pos.Offset })
+	return diags, err
+}
+
+// lintPieces checks the structure of doc, whose pieces begin at the given positions.
+func lintPieces(diags []Diagnostic, rules LintRules, doc Document, positions []Position) []Diagnostic {
+	type node struct {
+		pos   Position
+		name  string
+		empty bool
+		keys  map[string]bool
+	}
+	stack := []node{{keys: map[string]bool{}}}
+	for i, piece := range doc {
+		top := &stack[len(stack)-1]
+		switch piece.Kind() {
+		case KindField:
+			f, _ := fieldOf(piece)
+			top.empty = false
+			if rules.DuplicateKeys && top.keys[f.Key] {
+				diags = append(diags, Diagnostic{positions[i], SeverityWarning, "DuplicateKeys",
+					fmt.Sprintf("duplicate key %q", f.Key)})
+			}
+			top.keys[f.Key] = true
+		case KindNodeEnter:
+			name, _ := enterName(piece)
+			top.empty = false
+			stack = append(stack, node{pos: positions[i], name: name, empty: true, keys: map[string]bool{}})
+		case KindNodeLeave:
+			if len(stack) == 1 {
+				continue
+			}
+			if rules.EmptyNodes && top.empty {
+				diags = append(diags, Diagnostic{top.pos, SeverityInfo, "EmptyNodes",
+					fmt.Sprintf("empty node %q", top.name)})
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return diags
+}
+
+// lintText checks the text of the input, read by p, line by line.
+func lintText(diags []Diagnostic, rules LintRules, text []byte, p *Parser) []Diagnostic {
+	var indentRune rune
+	pos := Position{Line: 1, Column: 1}
+	for len(text) > 0 {
+		line, next := text, len(text)
+		if i := bytes.IndexByte(text, '\n'); i >= 0 {
+			line, next = text[:i], i+1
+		}
+		text = text[next:]
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+
+		if rules.MixedIndent {
+			indent := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]
+			if indentRune == 0 && len(indent) > 0 {
+				indentRune = rune(indent[0])
+			}
+			if bytes.ContainsRune(indent, ' ') && bytes.ContainsRune(indent, '\t') {
+				diags = append(diags, Diagnostic{pos, SeverityWarning, "MixedIndent",
+					"indentation mixes tabs and spaces"})
+			} else if len(indent) > 0 && len(indent) < len(line) && rune(indent[0]) != indentRune {
+				diags = append(diags, Diagnostic{pos, SeverityWarning, "MixedIndent",
+					fmt.Sprintf("indented by %q, but earlier lines are indented by %q", indent[0], indentRune)})
+			}
+		}
+
+		if rules.TrailingWhitespace {
+			end := len(bytes.TrimRight(line, " \t"))
+			if end < len(line) && escapedAt(line, end) {
+				end++ // The first trailing space is kept by its escape.
+			}
+			if end < len(line) {
+				diags = append(diags, Diagnostic{advance(pos, line[:end]), SeverityWarning, "TrailingWhitespace",
+					"trailing whitespace"})
+			}
+		}
+
+		if rules.Escapes {
+			diags = lintEscapes(diags, pos, line, p)
+		}
+
+		pos = Position{Offset: pos.Offset + next, Line: pos.Line + 1, Column: 1}
+	}
+	return diags
+}
+
+// lintEscapes reports escapes in line, which begins at pos, of runes that need no escaping when read by p. Comments are
+// skipped.
+func lintEscapes(diags []Diagnostic, pos Position, line []byte, p *Parser) []Diagnostic {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '#':
+			return diags
+		case '\\':
+			if i+1 == len(line) {
+				return diags // Continues onto the next line.
+			}
+			c, n := utf8.DecodeRune(line[i+1:])
+			if !p.escapable(c) {
+				diags = append(diags, Diagnostic{advance(pos, line[:i]), SeverityInfo, "Escapes",
+					fmt.Sprintf("unnecessary escape of %q", c)})
+			}
+			i += n
+		}
+	}
+	return diags
+}
+
+// escapable reports whether an escape of c may be needed for it to be read as-is by p, such as an escape of whitespace
+// in a key, of an AssignmentOps operator or ValueTerminators rune, of the '@' beginning a directive if Defines or
+// OnDirective is set, or of the '"' beginning a key if QuotedNames is set.
+func (p *Parser) escapable(c rune) bool {
+	if _, ok := escapes[c]; ok || strings.ContainsRune("\\#;{}!", c) || p.space(c) {
+		return true
+	}
+	return p.isAssignOp(c) || p.valueTerms != nil && p.endsValue(c) ||
+		c == '@' && (p.defines != nil || p.onDirective != nil) || c == '"' && p.quotedNames
+}
+
+// escapedAt reports whether the byte at i in line is escaped by a preceding backslash.
+func escapedAt(line []byte, i int) bool {
+	n := 0
+	for i > 0 && line[i-1] == '\\' {
+		i--
+		n++
+	}
+	return n%2 == 1
+}
+
+// advance returns pos moved past text, which holds no line endings.
+func advance(pos Position, text []byte) Position {
+	pos.Offset += len(text)
+	pos.Column += utf8.RuneCount(text)
+	return pos
+}
@@ -0,0 +1,57 @@
+package sparse_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nilium/sparse"
+)
+
+func TestLintEscapes(t *testing.T) {
+	noDirective := sparse.OnDirective(func(name, args string) error { return nil })
+	cases := []struct {
+		src     string
+		configs []sparse.Configuration
+	}{
+		{`\@if A`, []sparse.Configuration{sparse.Defines{"A": true}}},
+		{`\@include file`, []sparse.Configuration{noDirective}},
+		{`a\=b c`, []sparse.Configuration{sparse.AssignmentOps{'='}}},
+		{`k \= v`, []sparse.Configuration{sparse.AssignmentOps{'='}}},
+		{`a\:b c`, []sparse.Configuration{sparse.AssignmentOps{'=', ':'}}},
+		{`k a\,b`, []sparse.Configuration{sparse.ValueTerminators{','}}},
+		{`\"name {}`, []sparse.Configuration{sparse.QuotedNames(true)}},
+	}
+	for _, c := range cases {
+		// Without the configuration, the escape does nothing and is reported.
+		diags, err := sparse.Lint(strings.NewReader(c.src), sparse.LintRules{Escapes: true})
+		if err != nil {
+			t.Fatalf("Lint(%q) = %v", c.src, err)
+		} else if len(diags) != 1 || diags[0].Rule != "Escapes" {
+			t.Errorf("Lint(%q) = %v; want one Escapes diagnostic", c.src, diags)
+		}
+
+		// With it, the escape is needed, since the input reads differently without it.
+		diags, err = sparse.Lint(strings.NewReader(c.src), sparse.LintRules{Escapes: true}, c.configs...)
+		if err != nil {
+			t.Fatalf("Lint(%q) = %v", c.src, err)
+		} else if len(diags) != 0 {
+			t.Errorf("Lint(%q) = %v; want no diagnostics", c.src, diags)
+		}
+		escaped, _ := sparse.Parse(strings.NewReader(c.src), c.configs...)
+		unescaped, _ := sparse.Parse(strings.NewReader(strings.Replace(c.src, `\`, "", 1)), c.configs...)
+		if reflect.DeepEqual(escaped, unescaped) {
+			t.Errorf("%q reads as %#v with or without its escape", c.src, escaped)
+		}
+	}
+}
+
+func TestLintEscapesAlwaysNeeded(t *testing.T) {
+	src := `a\ b \#\;\{\}\!\\\t\n\` + "\u00a0x\n" // The last escape is of a no-break space.
+	diags, err := sparse.Lint(strings.NewReader(src), sparse.LintRules{Escapes: true})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(diags) != 0 {
+		t.Errorf("Lint(%q) = %v; want no diagnostics", src, diags)
+	}
+}
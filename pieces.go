@@ -1,6 +1,12 @@
 package sparse
 
-import "fmt"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
 
 type Kind interface {
 	kind()
@@ -15,6 +21,7 @@ const (
 	KindComment
 	KindNodeEnter
 	KindNodeLeave
+	KindError
 )
 
 type Piece interface {
@@ -23,35 +30,356 @@ type Piece interface {
 	String() string
 }
 
+// IsStructural reports whether p enters or leaves a node.
+func IsStructural(p Piece) bool {
+	switch p.Kind() {
+	case KindNodeEnter, KindNodeLeave:
+		return true
+	}
+	return false
+}
+
+// IsContent reports whether p is a field or comment.
+func IsContent(p Piece) bool {
+	switch p.Kind() {
+	case KindField, KindComment:
+		return true
+	}
+	return false
+}
+
 type Field struct{ Key, Value string }
 
+// fieldOf returns the Field held by p, if p is a field.
+func fieldOf(p Piece) (Field, bool) {
+	switch p := p.(type) {
+	case Field:
+		return p, true
+	case FieldEx:
+		return p.Field, true
+	case BlobField:
+		return p.field(), true
+	}
+	return Field{}, false
+}
+
 func (Field) piece() {}
-func (f Field) String() string {
-	if f.Value == "" {
-		return keyEscaper.Replace(f.Key) + "!"
+
+// WithValue returns a copy of f with its value replaced by value.
+func (f Field) WithValue(value string) Field {
+	f.Value = value
+	return f
+}
+
+// ParseValue parses the value of f as a Document. Positions in any error returned are relative to the start of the
+// value.
+func (f Field) ParseValue(configs ...Configuration) (Document, error) {
+	return Parse(strings.NewReader(f.Value), configs...)
+}
+
+// Attrs parses the value of f as whitespace-separated attributes, such as "src=one dst=zero", and returns them as a
+// map from each attribute's name to its value. Each attribute is split at its first '='. An attribute with no '=' maps
+// to the empty string, and an attribute occurring more than once maps to its last value. Double quotes may be used to
+// include whitespace or '=' in a name or value, as in title="a b", and are removed, with a backslash within quotes
+// escaping the rune following it.
+func (f Field) Attrs() map[string]string {
+	attrs := make(map[string]string)
+	var b strings.Builder
+	var name string
+	var named, content, quoted, escape bool
+	end := func() {
+		if !content {
+			return
+		}
+		if named {
+			attrs[name] = b.String()
+		} else {
+			attrs[b.String()] = ""
+		}
+		b.Reset()
+		named, content = false, false
 	}
-	return keyEscaper.Replace(f.Key) + " " + valueEscaper.Replace(f.Value)
+
+	for _, c := range f.Value {
+		switch {
+		case escape:
+			escape = false
+			b.WriteRune(c)
+		case quoted && c == '\\':
+			escape = true
+		case c == '"':
+			quoted, content = !quoted, true
+		case quoted:
+			b.WriteRune(c)
+		case unicode.IsSpace(c):
+			end()
+		case c == '=' && !named:
+			name, named, content = b.String(), true, true
+			b.Reset()
+		default:
+			b.WriteRune(c)
+			content = true
+		}
+	}
+	end()
+	return attrs
+}
+func (f Field) String() string { return f.encode(valueEscaper, false) }
+
+// encode returns the text of f, with its value escaped by the given value escaper. If quote is set, an empty key is
+// written as "", so that a field with a value is read back with an empty key if QuotedNames is set.
+func (f Field) encode(values *strings.Replacer, quote bool) string {
+	key := escapeKey(f.Key)
+	if quote && key == "" {
+		key = `""`
+	}
+	if f.Value == "" && key == "" {
+		// A lone '!' would be read as a negation prefix if NegationPrefix is set.
+		return ";"
+	} else if f.Value == "" {
+		return key + "!"
+	}
+	return key + " " + escapeValue(f.Value, values)
 }
 func (f Field) Kind() Kind       { return KindField }
 func (f Field) GoString() string { return fmt.Sprintf("%T(%q: %q)", f, f.Key, f.Value) }
 
+// MarshalText returns f as it would be written by an Encoder. It returns ErrEmptyKey if f has a value but no key, since
+// no unquoted key is read back as empty.
+func (f Field) MarshalText() ([]byte, error) {
+	if f.Key == "" && f.Value != "" {
+		return nil, ErrEmptyKey
+	}
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText parses text, which must hold a single field, into f. Runs of whitespace in its value are kept, as if
+// CompressWhitespace were disabled, so that text returned by MarshalText is read back as the same field.
+func (f *Field) UnmarshalText(text []byte) error {
+	piece, err := unmarshalPiece(text, KindField, CompressWhitespace(false))
+	if err != nil {
+		return err
+	}
+	*f, _ = fieldOf(piece)
+	return nil
+}
+
+// ErrNotSinglePiece is returned by the UnmarshalText methods of pieces when the text given does not hold exactly one
+// piece of the kind being unmarshaled.
+var ErrNotSinglePiece = errors.New("sparse: text does not hold a single piece of the expected kind")
+
+// unmarshalPiece parses text, which must hold a single piece of the given kind, and returns that piece.
+func unmarshalPiece(text []byte, kind Kind, configs ...Configuration) (Piece, error) {
+	doc, err := Parse(bytes.NewReader(text), configs...)
+	if err != nil {
+		return nil, err
+	} else if len(doc) != 1 || doc[0].Kind() != kind {
+		return nil, ErrNotSinglePiece
+	}
+	return doc[0], nil
+}
+
+// FieldEx is a Field carrying additional information about how it was read. It is read in place of Field when
+// NegationPrefix, KeepTerminators, or FieldDepth is set.
+//
+// Negated is set if the field's key was prefixed with '!'. Terminator is the '!' or ';', or other rune permitted by
+// ValueTerminators, that ended the field, if KeepTerminators is set and the field was ended by one, and is otherwise
+// zero. A line ending is not recorded as a terminator. TerminatorKept is set if KeepTerminators is set, so that a zero
+// Terminator records a field ended by a line ending rather than one whose terminator wasn't recorded. Depth is the
+// depth of the node holding the field, if FieldDepth is set, and is otherwise zero.
+type FieldEx struct {
+	Field
+	Negated        bool
+	Terminator     rune
+	TerminatorKept bool
+	Depth          int
+}
+
+func (FieldEx) piece()           {}
+func (f FieldEx) String() string { return f.encode(valueEscaper, false) }
+
+// encode returns the text of f as Field.encode does, including its negation and terminator.
+func (f FieldEx) encode(values *strings.Replacer, quote bool) string {
+	s := f.Field.encode(values, quote)
+	if f.Terminator == ';' && f.Value == "" {
+		s = s[:len(s)-1] + ";" // Replace the '!'
+	} else if f.TerminatorKept && f.Terminator == 0 && f.Value == "" && s != ";" {
+		// Continuing the field onto a blank line ends it without a terminator.
+		s = s[:len(s)-1] + " \\\n"
+	} else if f.Terminator != 0 && f.Terminator != '!' && f.Value != "" {
+		s += string(f.Terminator)
+	}
+	if f.Negated {
+		s = "!" + s
+	}
+	return s
+}
+func (f FieldEx) Kind() Kind { return KindField }
+func (f FieldEx) GoString() string {
+	return fmt.Sprintf("%T(%q: %q, negated=%t, terminator=%q, kept=%t, depth=%d)", f, f.Key, f.Value, f.Negated,
+		f.Terminator, f.TerminatorKept, f.Depth)
+}
+
+// MarshalText returns f as it would be written by an Encoder, including its negation and terminator. Like
+// Field.MarshalText, it returns ErrEmptyKey if f has a value but no key.
+func (f FieldEx) MarshalText() ([]byte, error) {
+	if f.Key == "" && f.Value != "" {
+		return nil, ErrEmptyKey
+	}
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText parses text, which must hold a single field, into f as Field.UnmarshalText does, and as if
+// NegationPrefix and KeepTerminators were set.
+func (f *FieldEx) UnmarshalText(text []byte) error {
+	piece, err := unmarshalPiece(text, KindField, CompressWhitespace(false), NegationPrefix(true), KeepTerminators(true))
+	if err != nil {
+		return err
+	}
+	*f = piece.(FieldEx)
+	return nil
+}
+
 type Comment string
 
-func (Comment) piece()             {}
-func (c Comment) String() string   { return "#" + string(c) }
+func (Comment) piece() {}
+func (c Comment) String() string {
+	// Comments end at the end of a line, so each line of a multi-line comment is its own comment. A '\r' ending a line
+	// is read as part of the line ending, so lines ending in '\r' are given another.
+	lines := strings.Split(string(c), "\n")
+	for i, line := range lines {
+		if strings.HasSuffix(line, "\r") {
+			lines[i] = line + "\r"
+		}
+	}
+	return "#" + strings.Join(lines, "\n#")
+}
 func (c Comment) Kind() Kind       { return KindComment }
 func (c Comment) GoString() string { return fmt.Sprintf("%T(%q)", c, string(c)) }
 
+// MarshalText returns c as it would be written by an Encoder, with each of its lines prefixed by '#'.
+func (c Comment) MarshalText() ([]byte, error) { return []byte(c.String()), nil }
+
+// UnmarshalText parses text, which must hold a single comment, into c. A comment spanning several lines, each
+// prefixed by '#', is read as one comment, as if MergeComments were set.
+func (c *Comment) UnmarshalText(text []byte) error {
+	piece, err := unmarshalPiece(text, KindComment, ReadComments(true), MergeComments(true))
+	if err != nil {
+		return err
+	}
+	*c = piece.(Comment)
+	return nil
+}
+
+// DocComment is a comment carrying its position in the input and whether it trails other content on the same line.
+// It is read in place of Comment when DocComments is set, so that comments can be associated with the pieces that
+// follow them: a standalone DocComment whose line immediately precedes the line of a field (see Parser.Pos)
+// documents that field.
+//
+// Pos is the position of the comment's '#' and End the position of the line ending that ends it, or of the end of
+// input, so that the input from Pos up to End holds the whole of the comment's text. The line ending, including any
+// carriage return, is not included. The End of comments merged by MergeComments is that of the last line merged.
+type DocComment struct {
+	Text   string
+	Pos    Position
+	End    Position
+	Inline bool
+}
+
+func (DocComment) piece()           {}
+func (c DocComment) String() string { return Comment(c.Text).String() }
+func (c DocComment) Kind() Kind     { return KindComment }
+func (c DocComment) GoString() string {
+	return fmt.Sprintf("%T(%q, %v-%v, inline=%t)", c, c.Text, c.Pos, c.End, c.Inline)
+}
+
 type NodeEnter string
 
-func (NodeEnter) piece()             {}
-func (s NodeEnter) String() string   { return string(s) + "{" }
+func (NodeEnter) piece() {}
+func (s NodeEnter) String() string {
+	if s == "" {
+		return "{"
+	}
+	return escapeKey(string(s)) + " {"
+}
 func (s NodeEnter) Kind() Kind       { return KindNodeEnter }
 func (s NodeEnter) GoString() string { return fmt.Sprintf("%T(%q)", s, string(s)) }
 
+// NodeEnterEx is a NodeEnter carrying its position in the input and the text of any comment following the node's
+// opening brace on the same line. It is read in place of NodeEnter when RichPieces is set. A comment attached to a
+// NodeEnterEx is not also read as a Comment.
+type NodeEnterEx struct {
+	NodeEnter
+	Pos     Position
+	Comment string
+}
+
+func (s NodeEnterEx) String() string {
+	if s.Comment == "" {
+		return s.NodeEnter.String()
+	}
+	return s.NodeEnter.String() + " " + Comment(s.Comment).String()
+}
+func (s NodeEnterEx) GoString() string {
+	return fmt.Sprintf("%T(%q, %v, comment=%q)", s, string(s.NodeEnter), s.Pos, s.Comment)
+}
+
+// enterName returns the name of the node entered by p, if p enters a node.
+func enterName(p Piece) (string, bool) {
+	switch p := p.(type) {
+	case NodeEnter:
+		return string(p), true
+	case NodeEnterEx:
+		return string(p.NodeEnter), true
+	}
+	return "", false
+}
+
+// NodeLeave leaves a node. Its value is the depth of the node being left, counted before leaving it, so a top-level
+// node is left by NodeLeave(1) and a node within it by NodeLeave(2). The implicit root read with WrapRoot is left by
+// NodeLeave(0).
 type NodeLeave int
 
+// Depth returns the depth of the node left by l.
+func (l NodeLeave) Depth() int { return int(l) }
+
 func (NodeLeave) piece()             {}
 func (NodeLeave) String() string     { return "}" }
 func (NodeLeave) Kind() Kind         { return KindNodeLeave }
 func (l NodeLeave) GoString() string { return fmt.Sprintf("%T(%d)", l, l) }
+
+// NamedNodeLeave is a NodeLeave carrying the name of the node it leaves. It is read in place of NodeLeave when
+// NamedLeaves is set.
+type NamedNodeLeave struct {
+	NodeLeave
+	Name string
+}
+
+func (l NamedNodeLeave) GoString() string { return fmt.Sprintf("%T(%q, %d)", l, l.Name, l.NodeLeave) }
+
+// ErrorPiece is a syntax error read in place of the rest of the line it occurred on, or the input up to the point set
+// by RecoverTo, when RecoverErrors is set. Pos is the position of the error and Text holds the text skipped after it.
+// Err is the error, as a *ParseError.
+type ErrorPiece struct {
+	Pos  Position
+	Text string
+	Err  error
+}
+
+func (ErrorPiece) piece()           {}
+func (e ErrorPiece) String() string { return e.Text }
+func (e ErrorPiece) Kind() Kind     { return KindError }
+func (e ErrorPiece) GoString() string {
+	return fmt.Sprintf("%T(%v, %q, %v)", e, e.Pos, e.Text, e.Err)
+}
+
+// leaveDepth returns the depth of the node left by p, if p leaves a node.
+func leaveDepth(p Piece) (int, bool) {
+	switch p := p.(type) {
+	case NodeLeave:
+		return int(p), true
+	case NamedNodeLeave:
+		return int(p.NodeLeave), true
+	}
+	return 0, false
+}
@@ -0,0 +1,34 @@
+package sparse_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nilium/sparse"
+)
+
+func TestNodeLeaveDepth(t *testing.T) {
+	const src = "a {\n\tb {\n\t\tc {\n\t\t}\n\t}\n\td { e {} }\n}\nf {}\n"
+	cases := []struct {
+		configs []sparse.Configuration
+		want    []int
+	}{
+		{nil, []int{3, 2, 3, 2, 1, 1}},
+		{[]sparse.Configuration{sparse.NamedLeaves(true)}, []int{3, 2, 3, 2, 1, 1}},
+		{[]sparse.Configuration{sparse.WrapRoot(true)}, []int{3, 2, 3, 2, 1, 1, 0}},
+	}
+	for _, c := range cases {
+		var got []int
+		for _, piece := range parse(t, src, c.configs...) {
+			switch l := piece.(type) {
+			case sparse.NodeLeave:
+				got = append(got, l.Depth())
+			case sparse.NamedNodeLeave:
+				got = append(got, l.Depth())
+			}
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("depths = %v; want %v", got, c.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package sparse
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Position is a location in a Parser's input. Offset is a zero-based byte offset. Line and Column are one-based, with
+// columns counted in runes.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Position) String() string { return fmt.Sprintf("%d:%d", p.Line, p.Column) }
+
+// ParseError is an error that occurred at a position in a Parser's input. If Snippet is set, it holds the text of the
+// line the error occurred on, up to and including the rune at Pos, and is included in the error message.
+type ParseError struct {
+	Pos     Position
+	Err     error
+	Snippet string
+}
+
+func (e *ParseError) Error() string {
+	if e.Snippet != "" {
+		return fmt.Sprintf("%v: %v near %q", e.Pos, e.Err, e.Snippet)
+	}
+	return fmt.Sprintf("%v: %v", e.Pos, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// Pos returns the position at which the piece last returned by Read begins.
+func (p *Parser) Pos() Position { return p.start }
+
+// End returns the position following the last rune of the piece last returned by Read, not counting any whitespace
+// following it. A field's span includes a ';' or '!' ending it, but not a brace or comment following it. The pieces
+// leaving nodes read with IndentStructure, and those of the implicit root read with WrapRoot, end where they begin.
+func (p *Parser) End() Position { return p.end }
+
+// Span is the range of a Parser's input holding a piece, from the position at which it begins up to, but not
+// including, the position at which it ends.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// Contains reports whether the byte at offset is within s.
+func (s Span) Contains(offset int) bool { return s.Start.Offset <= offset && offset < s.End.Offset }
+
+// readRune reads a single rune from r, passed through the parser's RuneFilter, and advances the parser's position past
+// it. Positions always refer to the unfiltered input. If the parser's ReadBudget is spent, it returns ErrWouldBlock
+// without reading from r.
+func (p *Parser) readRune(r Reader) (rune, int, error) {
+	if n := len(p.unread); n > 0 {
+		u := p.unread[n-1]
+		p.unread = p.unread[:n-1]
+		if u.err != nil {
+			return 0, 0, u.err
+		}
+		p.last, p.inline = u.last, u.inline
+		p.prevContent = p.lastContent
+		if !p.space(u.c) {
+			p.lastContent = Position{u.last.Offset + u.n, u.last.Line, u.last.Column + 1}
+		}
+		return u.c, u.n, nil
+	}
+	for {
+		if p.spent() {
+			return 0, 0, ErrWouldBlock
+		}
+		c, n, err := r.ReadRune()
+		if err != nil {
+			return c, n, err
+		}
+		p.runes++
+		if p.normalizeLineEndings {
+			if c == '\n' && p.cr {
+				// The '\r' before c was already read as the end of the line.
+				p.cr = false
+				p.pos.Offset += n
+				continue
+			}
+			if p.cr = c == '\r'; p.cr {
+				c = '\n'
+			}
+		}
+		p.advanceRune(c, n)
+		if p.filter == nil {
+			return c, n, nil
+		}
+		if c, ok := p.filter(c); ok {
+			return c, n, nil
+		}
+	}
+}
+
+// unread is a rune returned to the parser to be read again, along with the position it was read at, or an error
+// returned in place of a rune.
+type unread struct {
+	c      rune
+	n      int
+	last   Position
+	inline bool
+	err    error
+}
+
+// unreadRune returns c, the last rune read, to the parser so that it is read again by the next call to readRune. The
+// parser's position is not changed, since it already follows c.
+func (p *Parser) unreadRune(c rune, n int) {
+	p.unread = append(p.unread, unread{c: c, n: n, last: p.last, inline: p.inline})
+	p.lastContent = p.prevContent
+}
+
+func (p *Parser) advanceRune(c rune, n int) {
+	p.last = p.pos
+	p.prevContent = p.lastContent
+	p.inline = p.lineContent
+	p.pos.Offset += n
+	if p.indentStructure && !p.lineContent && (c == ' ' || c == '\t') {
+		p.indent = append(p.indent, byte(c))
+	}
+	if c == '\n' {
+		p.indent = p.indent[:0]
+		p.line = p.line[:0]
+		p.pos.Line++
+		p.pos.Column = 1
+		p.lineContent = false
+		return
+	}
+	p.appendLine(utf8.AppendRune(p.line, c))
+	p.pos.Column++
+	if !p.space(c) {
+		p.lineContent = true
+		p.lastContent = p.pos
+	}
+}
+
+// snippetLen is the most bytes of a line kept for the Snippet of a ParseError.
+const snippetLen = 40
+
+// appendLine sets the text of the current line read so far to line, keeping only enough of its end for a snippet.
+func (p *Parser) appendLine(line []byte) {
+	if len(line) > 2*snippetLen {
+		line = line[:copy(line, line[len(line)-snippetLen:])]
+	}
+	p.line = line
+}
+
+// snippet returns the end of the current line read so far, for the Snippet of a ParseError.
+func (p *Parser) snippet() string {
+	line := p.line
+	for len(line) > 0 && !utf8.RuneStart(line[0]) {
+		line = line[1:]
+	}
+	if len(line) > snippetLen {
+		line = line[len(line)-snippetLen:]
+		for len(line) > 0 && !utf8.RuneStart(line[0]) {
+			line = line[1:]
+		}
+	}
+	return string(bytes.TrimLeftFunc(line, p.space))
+}
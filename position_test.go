@@ -0,0 +1,43 @@
+package sparse_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nilium/sparse"
+	"github.com/nilium/sparse/sparsetest"
+)
+
+func TestNormalizeLineEndings(t *testing.T) {
+	const src = "# comment\na 1\nnode {\n\tgrid 1 \\\n\t\t2\n\n\tflag\n}\nlast value\n"
+	want := parse(t, src, sparse.ReadComments(true))
+	for _, eol := range []string{"\n", "\r\n", "\r"} {
+		text := strings.ReplaceAll(src, "\n", eol)
+		sparsetest.AssertPieces(t, parse(t, text, sparse.ReadComments(true), sparse.NormalizeLineEndings(true)), want...)
+
+		// A line ending at the very end of the input may be cut short.
+		text = strings.TrimSuffix(text, eol) + "\r"
+		sparsetest.AssertPieces(t, parse(t, text, sparse.ReadComments(true), sparse.NormalizeLineEndings(true)), want...)
+	}
+
+	// Lines are counted alike, whichever line endings are used.
+	_, lines, _ := sparse.ParseWithPositions(strings.NewReader(src), sparse.ReadComments(true))
+	for _, eol := range []string{"\r\n", "\r"} {
+		text := strings.ReplaceAll(src, "\n", eol)
+		_, positions, _ := sparse.ParseWithPositions(strings.NewReader(text), sparse.ReadComments(true),
+			sparse.NormalizeLineEndings(true))
+		if len(positions) != len(lines) {
+			t.Fatalf("%q: read %d pieces; want %d", eol, len(positions), len(lines))
+		}
+		for i := range positions {
+			if positions[i].Line != lines[i].Line || positions[i].Column != lines[i].Column {
+				t.Errorf("%q: piece %d at %v; want line %d, column %d", eol, i, positions[i], lines[i].Line,
+					lines[i].Column)
+			}
+		}
+	}
+
+	// Without the option, lines ending in a lone '\r' run together.
+	doc := parse(t, "a 1\rb 2\r")
+	sparsetest.AssertPieces(t, doc, sparse.Field{Key: "a", Value: "1b 2"})
+}
@@ -1,15 +1,32 @@
 package sparse
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"io"
 	"unicode"
+	"unicode/utf8"
 )
 
+// Reader is the input read by a Parser. Runs of ASCII within keys and values are read in bulk, rather than a rune at a
+// time, from readers whose unread input can be inspected: a *bufio.Reader, and readers of input held in memory, such as
+// a *strings.Reader or *bytes.Reader. Other readers are read a rune at a time, and should be given a *bufio.Reader to
+// read from for speed. Runes are always read one at a time if a RuneFilter or SpaceFunc is set.
 type Reader interface {
 	io.Reader
 	io.RuneReader
 }
 
+// Wrap returns r as a Reader. If r is not already a Reader, it is buffered and its runes decoded as UTF-8, including
+// runes split across calls to its Read method.
+func Wrap(r io.Reader) Reader {
+	if r, ok := r.(Reader); ok {
+		return r
+	}
+	return bufio.NewReader(r)
+}
+
 type ASCIIReader struct{ io.Reader }
 
 func (r ASCIIReader) ReadByte() (byte, error) {
@@ -31,3 +48,189 @@ func (r ASCIIReader) ReadRune() (rune, int, error) {
 func (r ASCIIReader) ReadBytes(delim byte) ([]byte, error) {
 	return readUntil(r.Reader, delim)
 }
+
+// gzipMagic is the header that begins a gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// NewCompressedReader returns a buffered Reader for r. If r begins with a gzip header, the Reader returned reads the
+// decompressed stream. Otherwise, it reads r as-is. An error is returned if r cannot be read or its gzip header is
+// invalid.
+func NewCompressedReader(r io.Reader) (Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err == io.EOF || (err == nil && !bytes.Equal(magic, gzipMagic)) {
+		return br, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(zr), nil
+}
+
+// bufferedReader is implemented by readers, such as *bufio.Reader, whose buffered input can be inspected before it is
+// read.
+type bufferedReader interface {
+	Buffered() int
+	Peek(n int) ([]byte, error)
+	Discard(n int) (int, error)
+}
+
+// memReader is implemented by readers of input held in memory, such as *strings.Reader and *bytes.Reader, whose
+// unread input can be inspected with ReadAt before it is read.
+type memReader interface {
+	io.ReaderAt
+	io.Seeker
+	Len() int
+	Size() int64
+}
+
+// memPeekLen is the number of bytes of a memReader inspected at once by readRun.
+const memPeekLen = 256
+
+// readRun copies the run of ASCII that follows the last rune read, up to the next byte that needs to be interpreted,
+// directly into the parser's buffer. It does nothing unless r is a bufferedReader, whose buffered input is inspected,
+// or a memReader. It also does nothing if a RuneFilter or SpaceFunc is set, since either may change how each rune is
+// read. last is the last rune written to the buffer and the new last rune written is returned. The run is cut short by
+// the parser's ReadBudget.
+//
+// The run excludes escapes, line endings, control characters, and anything else that could end a key (if key is set,
+// including assignment operators) or value (including ValueTerminators). A space may only occur in the run of a value
+// if it does not follow another space, so that the run is unaffected by whitespace compression.
+func (p *Parser) readRun(r Reader, key bool, last rune) rune {
+	if p.filter != nil || p.customSpace || len(p.unread) > 0 {
+		return last
+	}
+	br, buffered := r.(bufferedReader)
+	mr, inMemory := r.(memReader)
+	if !buffered && !inMemory {
+		return last
+	}
+
+	space := p.space(last)
+	for {
+		var b []byte
+		if buffered {
+			b, _ = br.Peek(br.Buffered())
+		} else {
+			b = p.peek[:]
+			if n := mr.Len(); n < len(b) {
+				b = b[:n]
+			}
+			n, _ := mr.ReadAt(b, mr.Size()-int64(mr.Len()))
+			b = b[:n]
+		}
+		if p.budget > 0 && len(b) > p.budget-p.runes {
+			b = b[:p.budget-p.runes]
+		}
+
+		n := 0
+		for ; n < len(b); n++ {
+			c := b[n]
+			if c <= ' ' || c >= utf8.RuneSelf {
+				if c != ' ' || key || space {
+					break
+				}
+				space = true
+				continue
+			}
+			switch c {
+			case '\\', ';', '#', '{', '}', '\x7f':
+				goto done
+			case '!':
+				if key {
+					goto done
+				}
+			}
+			if key && p.isAssignOp(rune(c)) || !key && p.valueTerms != nil && p.endsValue(rune(c)) {
+				break
+			}
+			space = false
+		}
+	done:
+		if n == 0 {
+			return last
+		}
+
+		p.buf.Write(b[:n])
+		p.appendLine(append(p.line, b[:n]...))
+		if buffered {
+			br.Discard(n)
+		} else {
+			mr.Seek(int64(n), io.SeekCurrent)
+		}
+		p.runes += n
+		p.pos.Offset += n
+		p.pos.Column += n
+		p.last = Position{p.pos.Offset - 1, p.pos.Line, p.pos.Column - 1}
+		p.inline, p.lineContent, p.cr = true, true, false
+		p.prevContent = p.lastContent
+		if b[n-1] != ' ' {
+			p.lastContent = p.pos
+		} else if n > 1 {
+			// Runs never hold more than one space in a row, so the byte before the space isn't a space.
+			p.lastContent = p.last
+		}
+		last = rune(b[n-1])
+		if n < len(b) || buffered || key && p.maxKeyLen > 0 && p.buf.Len() > p.maxKeyLen {
+			// A key too long for MaxKeyLen is read no further, so that it can be rejected.
+			return last
+		}
+	}
+}
+
+// TeeReader returns a Reader that reads from r and writes each byte it consumes to w, as io.TeeReader does. Runes are
+// decoded from the bytes of r, rather than by r, so that w receives exactly the bytes read, including those of invalid
+// UTF-8 read as unicode.ReplacementChar. Bytes read ahead from r to decode a rune are held until they are consumed.
+// Errors writing to w are returned by the read that caused them.
+func TeeReader(r Reader, w io.Writer) Reader {
+	return &teeReader{r: r, w: w}
+}
+
+type teeReader struct {
+	r       Reader
+	w       io.Writer
+	pending [utf8.UTFMax]byte // bytes read from r but not yet consumed
+	n       int               // length of pending
+	err     error             // error read from r after pending
+}
+
+func (t *teeReader) Read(b []byte) (int, error) {
+	var n int
+	var err error
+	if t.n > 0 {
+		n = copy(b, t.pending[:t.n])
+		t.n = copy(t.pending[:], t.pending[n:t.n])
+	} else if t.err != nil {
+		return 0, t.err
+	} else {
+		n, err = t.r.Read(b)
+	}
+	if n > 0 {
+		if _, werr := t.w.Write(b[:n]); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (t *teeReader) ReadRune() (rune, int, error) {
+	for !utf8.FullRune(t.pending[:t.n]) && t.err == nil {
+		var n int
+		n, t.err = t.r.Read(t.pending[t.n:])
+		t.n += n
+	}
+	if t.n == 0 {
+		return 0, 0, t.err
+	}
+
+	c, size := utf8.DecodeRune(t.pending[:t.n])
+	if _, werr := t.w.Write(t.pending[:size]); werr != nil {
+		return 0, 0, werr
+	}
+	t.n = copy(t.pending[:], t.pending[size:t.n])
+	return c, size, nil
+}
@@ -0,0 +1,177 @@
+package sparse
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// MultiError is a list of errors collected by a Parser with Recover set.
+type MultiError []error
+
+func (e MultiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e MultiError) Unwrap() []error { return e }
+
+// Errors returns the syntax errors skipped by the parser since it was last reset, if Recover is set and RecoverErrors
+// is not.
+func (p *Parser) Errors() []error { return p.errs }
+
+// recoverable reports whether err is a syntax error the parser can skip past, if Recover is set.
+func (p *Parser) recoverable(err error) bool {
+	if !p.recover || p.indentStructure {
+		return false
+	}
+	for _, target := range []error{
+		ErrUnexpectedNodeLeave, ErrInvalidNodeName, ErrEmptyKey, ErrUnmatchedEndif, ErrSectionDepth,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// skip records err, which must be recoverable, as an error skipped by the parser. If RecoverErrors is set, the error
+// is returned as an ErrorPiece instead, and nil otherwise.
+func (p *Parser) skip(err error) Piece {
+	perr, ok := err.(*ParseError)
+	if !ok && !errors.As(err, &perr) {
+		perr = &ParseError{Pos: p.start, Err: err}
+	}
+	if p.errorPieces {
+		return ErrorPiece{Pos: perr.Pos, Err: perr}
+	}
+	p.errs = append(p.errs, perr)
+	return nil
+}
+
+// skipError returns a parser that discards the input following err, as set by RecoverTo, before reading the next key.
+// If piece is an ErrorPiece, the text discarded is recorded in it and it is returned once the text has been read.
+func (p *Parser) skipError(piece Piece, err error) parser {
+	// A field rejected once read in full, such as for its empty key, may have ended its line already.
+	lineEnded := len(p.unread) == 0 && p.pos.Offset > 0 && p.pos.Column == 1
+	switch p.recoverTo {
+	case RecoverToBlankLine:
+		return p.skipParagraph(piece, !lineEnded)
+	case RecoverToNode:
+		depth := 0
+		if errors.Is(err, ErrInvalidNodeName) {
+			// The node's '{' was read, but the node wasn't entered.
+			depth = 1
+		} else if lineEnded && p.depth == 0 {
+			return p.skipLine(piece, true)
+		}
+		return p.skipNode(piece, depth)
+	}
+	return p.skipLine(piece, lineEnded)
+}
+
+// skipLine returns a parser that discards the rest of the current line before reading the next key. If lineEnded is
+// true, the last rune read ended the line, and nothing is discarded.
+func (p *Parser) skipLine(piece Piece, lineEnded bool) parser {
+	var read parser
+	read = readFn(func(r Reader) (parser, Piece, error) {
+		if lineEnded {
+			return p.skipped(piece, nil, nil)
+		}
+		c, _, err := p.readRune(r)
+		for c != '\n' && err == nil {
+			p.buf.WriteRune(c)
+			c, _, err = p.readRune(r)
+		}
+		if err == ErrWouldBlock {
+			return read, nil, err
+		}
+		return p.skipped(piece, bytes.TrimSuffix(p.buf.Bytes(), []byte{'\r'}), err)
+	})
+	return read
+}
+
+// skipParagraph returns a parser that discards the rest of the current line and the lines following it up to and
+// including the next blank line before reading the next key. If content is false, the last rune read ended the line the
+// error occurred on, and a blank line following it ends the paragraph at once.
+func (p *Parser) skipParagraph(piece Piece, content bool) parser {
+	var read parser
+	read = readFn(func(r Reader) (parser, Piece, error) {
+		c, _, err := p.readRune(r)
+		for err == nil {
+			if c == '\n' && !content {
+				break
+			} else if c == '\n' {
+				content = false
+			} else if !p.space(c) {
+				content = true
+			}
+			p.buf.WriteRune(c)
+			c, _, err = p.readRune(r)
+		}
+		if err == ErrWouldBlock {
+			return read, nil, err
+		}
+		return p.skipped(piece, bytes.TrimRightFunc(p.buf.Bytes(), p.space), err)
+	})
+	return read
+}
+
+// skipNode returns a parser that discards the rest of the node the parser is in, along with any nodes entered within
+// it, up to the '}' leaving it, which is then read as usual. At the top level, where no '}' leaves the node, only the
+// rest of the line and any nodes entered on it are discarded. If depth is non-zero, the error rejected a node being
+// entered, and only the input up to and including the '}' leaving it is discarded.
+func (p *Parser) skipNode(piece Piece, depth int) parser {
+	rejected := depth > 0
+	var escape, comment bool
+	var read parser
+	read = readFn(func(r Reader) (parser, Piece, error) {
+		c, n, err := p.readRune(r)
+		for err == nil {
+			if escape {
+				escape = false
+			} else if c == '\n' && depth == 0 && p.depth == 0 {
+				break
+			} else if comment {
+				comment = c != '\n'
+			} else if c == '\\' {
+				escape = true
+			} else if c == '#' {
+				comment = true
+			} else if c == '{' {
+				depth++
+			} else if c == '}' && depth == 1 && rejected {
+				break
+			} else if c == '}' && depth > 0 {
+				depth--
+			} else if c == '}' {
+				p.unreadRune(c, n)
+				break
+			}
+			p.buf.WriteRune(c)
+			c, n, err = p.readRune(r)
+		}
+		if err == ErrWouldBlock {
+			return read, nil, err
+		}
+		return p.skipped(piece, bytes.TrimRightFunc(p.buf.Bytes(), p.space), err)
+	})
+	return read
+}
+
+// skipped returns the parser following text discarded after an error, up to err, and piece. If piece is an
+// ErrorPiece, text is recorded in it.
+func (p *Parser) skipped(piece Piece, text []byte, err error) (parser, Piece, error) {
+	if e, ok := piece.(ErrorPiece); ok {
+		e.Text = string(text)
+		piece = e
+	}
+	p.buf.Reset()
+	if err != nil {
+		return errReader{err}, piece, err
+	}
+	return readFn(p.readKey), piece, nil
+}
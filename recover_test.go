@@ -0,0 +1,141 @@
+package sparse_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nilium/sparse"
+	"github.com/nilium/sparse/sparsetest"
+)
+
+func TestRecover(t *testing.T) {
+	a, b := sparse.Field{Key: "a", Value: "1"}, sparse.Field{Key: "b", Value: "2"}
+	cases := []struct {
+		src     string
+		recover bool
+		want    []sparse.Piece
+		errs    []sparse.Position // the positions of the errors returned
+	}{
+		// Without Recover, the pieces read before the error are returned along with it.
+		{"a 1\n}\nb 2", false, []sparse.Piece{a}, []sparse.Position{{Offset: 4, Line: 2, Column: 1}}},
+		{"}\na 1", false, nil, []sparse.Position{{Offset: 0, Line: 1, Column: 1}}},
+		{"a 1\n}\nb 2", true, []sparse.Piece{a, b}, []sparse.Position{{Offset: 4, Line: 2, Column: 1}}},
+		{"}\na 1\n} x\nb 2\n", true, []sparse.Piece{a, b}, []sparse.Position{
+			{Offset: 0, Line: 1, Column: 1}, {Offset: 6, Line: 3, Column: 1},
+		}},
+		{"n {\n\ta 1\n}}\nb 2", true, []sparse.Piece{sparse.NodeEnter("n"), a, sparse.NodeLeave(1), b},
+			[]sparse.Position{{Offset: 10, Line: 3, Column: 2}}},
+		{"a 1\nb 2", true, []sparse.Piece{a, b}, nil},
+	}
+	for _, c := range cases {
+		doc, err := sparse.Parse(strings.NewReader(c.src), sparse.Recover(c.recover))
+		sparsetest.AssertPieces(t, doc, c.want...)
+
+		errs := []error{err}
+		if c.errs == nil && err != nil {
+			t.Errorf("Parse(%q) = %v; want no error", c.src, err)
+			continue
+		} else if c.errs == nil {
+			continue
+		} else if me, ok := err.(sparse.MultiError); ok {
+			errs = me
+		} else if c.recover {
+			t.Errorf("Parse(%q) = %#v; want a MultiError", c.src, err)
+			continue
+		}
+		if !errors.Is(err, sparse.ErrUnexpectedNodeLeave) {
+			t.Errorf("Parse(%q) = %v; want %v", c.src, err, sparse.ErrUnexpectedNodeLeave)
+		}
+		if len(errs) != len(c.errs) {
+			t.Errorf("Parse(%q) = %v; want %d errors", c.src, err, len(c.errs))
+			continue
+		}
+		for i, e := range errs {
+			var perr *sparse.ParseError
+			if !errors.As(e, &perr) {
+				t.Errorf("Parse(%q) error %d = %#v; want a *ParseError", c.src, i, e)
+			} else if perr.Pos != c.errs[i] {
+				t.Errorf("Parse(%q) error %d at %#v; want %#v", c.src, i, perr.Pos, c.errs[i])
+			}
+		}
+
+		// Parser.Errors holds the same errors as the MultiError returned by Parse.
+		if !c.recover {
+			continue
+		}
+		p := sparse.NewParser(sparse.Recover(true))
+		r := strings.NewReader(c.src)
+		for err = nil; err == nil; {
+			_, err = p.Read(r)
+		}
+		if err != io.EOF {
+			t.Errorf("Read = %v; want %v", err, io.EOF)
+		} else if got, want := sparse.MultiError(p.Errors()), sparse.MultiError(errs); got.Error() != want.Error() {
+			t.Errorf("Errors() = %v; want %v", got, want)
+		}
+		if p.ResetKeep(); len(p.Errors()) != 0 {
+			t.Errorf("Errors() = %v after ResetKeep; want none", p.Errors())
+		}
+	}
+}
+
+func TestRecoverReadError(t *testing.T) {
+	errRead := errors.New("read failed")
+	doc, err := sparse.Parse(errAfter("}\na 1\n", errRead), sparse.Recover(true))
+	sparsetest.AssertPieces(t, doc, sparse.Field{Key: "a", Value: "1"})
+	me, ok := err.(sparse.MultiError)
+	if !ok || len(me) != 2 {
+		t.Fatalf("Parse = %#v; want a MultiError of the error skipped and the read error", err)
+	}
+	if !errors.Is(me[0], sparse.ErrUnexpectedNodeLeave) || !errors.Is(me[1], errRead) {
+		t.Errorf("Parse = %v; want %v followed by %v", err, sparse.ErrUnexpectedNodeLeave, errRead)
+	}
+	if !errors.Is(err, errRead) || !errors.Is(err, sparse.ErrUnexpectedNodeLeave) {
+		t.Errorf("MultiError %v doesn't unwrap to each of its errors", err)
+	}
+}
+
+func TestRecoverErrors(t *testing.T) {
+	leave := func(offset, line, col int, text string) sparse.ErrorPiece {
+		pos := sparse.Position{Offset: offset, Line: line, Column: col}
+		err := &sparse.ParseError{Pos: pos, Err: sparse.ErrUnexpectedNodeLeave, Snippet: "}"}
+		return sparse.ErrorPiece{Pos: pos, Text: text, Err: err}
+	}
+	doc, err := sparse.Parse(strings.NewReader("}\na 1\n} x\nb 2\n"), sparse.RecoverErrors(true))
+	if err != nil {
+		t.Fatalf("Parse = %v; want no error", err)
+	}
+	sparsetest.AssertPieces(t, doc,
+		leave(0, 1, 1, ""),
+		sparse.Field{Key: "a", Value: "1"},
+		leave(6, 3, 1, " x"),
+		sparse.Field{Key: "b", Value: "2"},
+	)
+}
+
+func TestRecoverEmptyKey(t *testing.T) {
+	a, b, c := sparse.Field{Key: "a", Value: "1"}, sparse.Field{Key: "b", Value: "2"}, sparse.Field{Key: "c", Value: "3"}
+	cases := []struct {
+		src  string
+		to   sparse.RecoverTo
+		want []sparse.Piece
+	}{
+		// The field with an empty key was read to the end of its line, so the line following it is kept.
+		{"a 1\n= x\nb 2", sparse.RecoverToLine, []sparse.Piece{a, b}},
+		{"a 1\n= x; b 2\nc 3", sparse.RecoverToLine, []sparse.Piece{a, c}},
+		{"a 1\n= x\nb 2\n\nc 3", sparse.RecoverToBlankLine, []sparse.Piece{a, c}},
+		{"a 1\n= x\n\nb 2", sparse.RecoverToBlankLine, []sparse.Piece{a, b}},
+		{"a 1\n= x\nb 2", sparse.RecoverToNode, []sparse.Piece{a, b}},
+		{"n {\n\t= x\n\ta 1\n}\nb 2", sparse.RecoverToNode, []sparse.Piece{sparse.NodeEnter("n"), sparse.NodeLeave(1), b}},
+	}
+	for _, c := range cases {
+		doc, err := sparse.Parse(strings.NewReader(c.src),
+			sparse.Recover(true), c.to, sparse.RejectEmptyKeys(true), sparse.AssignmentOps{'='})
+		sparsetest.AssertPieces(t, doc, c.want...)
+		if me, ok := err.(sparse.MultiError); !ok || len(me) != 1 || !errors.Is(me[0], sparse.ErrEmptyKey) {
+			t.Errorf("Parse(%q) = %v; want %v", c.src, err, sparse.ErrEmptyKey)
+		}
+	}
+}
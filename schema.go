@@ -0,0 +1,114 @@
+package sparse
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrMissingField = errors.New("sparse: missing required field")
+	ErrUnknownField = errors.New("sparse: unknown field")
+	ErrUnknownNode  = errors.New("sparse: unknown node")
+)
+
+// Schema describes the fields and child nodes permitted in a Node.
+//
+// Nodes maps child node names to the Schema used to validate them. A nil Schema in Nodes permits the child node
+// without validating its contents. Fields maps field keys to the rule used to validate their values.
+//
+// Unless Strict is set, fields and nodes not named by the schema are ignored.
+type Schema struct {
+	Nodes  map[string]*Schema
+	Fields map[string]FieldRule
+	Strict bool
+}
+
+// FieldRule describes a field permitted by a Schema. If Required is set, the field must occur at least once in the
+// node. If Check is not nil, it is called with the value of each occurrence of the field and any error it returns is
+// reported as a violation.
+type FieldRule struct {
+	Required bool
+	Check    func(value string) error
+}
+
+// SchemaError is a violation of a Schema. Path holds the names of the nodes, from the root, leading to the node in
+// which the violation occurred. Key is the key of the field or name of the node at fault.
+type SchemaError struct {
+	Path []string
+	Key  string
+	Err  error
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%v (node %q, key %q)", e.Err, e.Path, e.Key)
+}
+
+func (e *SchemaError) Unwrap() error { return e.Err }
+
+// OneOf returns a FieldRule check that accepts only the given values.
+func OneOf(values ...string) func(string) error {
+	return func(value string) error {
+		for _, v := range values {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("sparse: value %q is not one of %q", value, values)
+	}
+}
+
+// Validate checks root against the schema and returns all violations found, each as a *SchemaError. It returns nil
+// if root satisfies the schema.
+func (s *Schema) Validate(root *Node) []error {
+	return s.validate(nil, root, nil)
+}
+
+func (s *Schema) validate(path []string, node *Node, errs []error) []error {
+	seen := make(map[string]bool, len(s.Fields))
+	for _, f := range node.unfold(node.Fields) {
+		rule, ok := s.Fields[f.Key]
+		if !ok {
+			if s.Strict {
+				errs = append(errs, &SchemaError{path, f.Key, ErrUnknownField})
+			}
+			continue
+		}
+
+		seen[f.Key] = true
+		if rule.Check == nil {
+			continue
+		}
+		if err := rule.Check(f.Value); err != nil {
+			errs = append(errs, &SchemaError{path, f.Key, err})
+		}
+	}
+
+	var missing []string
+	for key, rule := range s.Fields {
+		if rule.Required && !seen[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		errs = append(errs, &SchemaError{path, key, ErrMissingField})
+	}
+
+	for _, child := range node.Children {
+		schema, ok := s.Nodes[child.Name]
+		if !ok {
+			if s.Strict {
+				errs = append(errs, &SchemaError{path, child.Name, ErrUnknownNode})
+			}
+			continue
+		}
+
+		if schema != nil {
+			childPath := append(path[:len(path):len(path)], child.Name)
+			errs = schema.validate(childPath, child, errs)
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,94 @@
+package sparse_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/nilium/sparse"
+)
+
+func TestSchemaFoldedKeys(t *testing.T) {
+	schema := &sparse.Schema{Fields: map[string]sparse.FieldRule{"blend": {Check: sparse.OneOf("add", "filter")}}}
+	doc := parse(t, "blend add\nblend bogus\nblend filter")
+	for _, fold := range []bool{false, true} {
+		root, err := sparse.BuildTree(doc, sparse.FoldRepeatedKeys(fold))
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs := schema.Validate(root)
+		if len(errs) != 1 {
+			t.Fatalf("Validate(fold=%t) = %v; want one error", fold, errs)
+		}
+		var want error = &sparse.SchemaError{Key: "blend", Err: sparse.OneOf("add", "filter")("bogus")}
+		if !reflect.DeepEqual(errs[0], want) {
+			t.Errorf("Validate(fold=%t) = %v; want %v", fold, errs[0], want)
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	errBad := errors.New("bad value")
+	stage := &sparse.Schema{
+		Fields: map[string]sparse.FieldRule{
+			"map":   {Required: true},
+			"blend": {Check: sparse.OneOf("add", "filter")},
+		},
+		Strict: true,
+	}
+	schema := &sparse.Schema{
+		Nodes: map[string]*sparse.Schema{
+			"stage": stage,
+			"any":   nil,
+			"outer": {Nodes: map[string]*sparse.Schema{"stage": stage}},
+		},
+		Fields: map[string]sparse.FieldRule{
+			"depth": {Required: true, Check: func(v string) error {
+				if v != "lte" {
+					return errBad
+				}
+				return nil
+			}},
+			"alpha": {Required: true},
+		},
+	}
+
+	cases := []struct {
+		src  string
+		want []error
+	}{
+		{"depth lte\nalpha always\nstage { map x }", nil},
+		{"depth lte\nalpha always\nunknown 1\nother { x 1 }\nany { x 1 }", nil}, // Not strict at the root.
+		{"depth gt\nalpha always", []error{&sparse.SchemaError{Key: "depth", Err: errBad}}},
+		{"", []error{
+			&sparse.SchemaError{Key: "alpha", Err: sparse.ErrMissingField},
+			&sparse.SchemaError{Key: "depth", Err: sparse.ErrMissingField},
+		}},
+		{"depth lte\nalpha always\nstage { blend mul; extra 1; sub { } }", []error{
+			&sparse.SchemaError{Path: []string{"stage"}, Key: "blend", Err: sparse.OneOf("add", "filter")("mul")},
+			&sparse.SchemaError{Path: []string{"stage"}, Key: "extra", Err: sparse.ErrUnknownField},
+			&sparse.SchemaError{Path: []string{"stage"}, Key: "map", Err: sparse.ErrMissingField},
+			&sparse.SchemaError{Path: []string{"stage"}, Key: "sub", Err: sparse.ErrUnknownNode},
+		}},
+		{"depth lte\nalpha always\nouter { stage { map x; blend add }; stage { } }", []error{
+			&sparse.SchemaError{Path: []string{"outer", "stage"}, Key: "map", Err: sparse.ErrMissingField},
+		}},
+	}
+	for _, c := range cases {
+		root, err := sparse.BuildTree(parse(t, c.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := schema.Validate(root); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Validate(%q) = %v; want %v", c.src, got, c.want)
+		}
+	}
+
+	err := error(&sparse.SchemaError{Path: []string{"outer", "stage"}, Key: "map", Err: sparse.ErrMissingField})
+	if !errors.Is(err, sparse.ErrMissingField) {
+		t.Errorf("%v doesn't unwrap to %v", err, sparse.ErrMissingField)
+	}
+	if got, want := err.Error(), `sparse: missing required field (node ["outer" "stage"], key "map")`; got != want {
+		t.Errorf("Error() = %q; want %q", got, want)
+	}
+}
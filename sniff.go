@@ -0,0 +1,161 @@
+package sparse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// sniffLen is the number of bytes read by Sniff.
+const sniffLen = 4096
+
+// utf8BOM is the UTF-8 encoding of the byte order mark.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// SniffResult holds the guesses made by Sniff about an input.
+type SniffResult struct {
+	// Reader reads the whole of the input given to Sniff, including the bytes read by Sniff, but not any byte order
+	// mark. It should be parsed in place of the input given to Sniff.
+	Reader Reader
+
+	BOM           bool   // whether the input begins with a UTF-8 byte order mark
+	CRLF          bool   // whether most lines end in "\r\n"
+	CR            bool   // whether most lines end in a lone '\r'
+	ASCII         bool   // whether the input holds only ASCII
+	UTF8          bool   // whether the input is valid UTF-8
+	Comments      bool   // whether lines beginning with '#' occur
+	AssignmentOps []rune // operators written between keys and values on most lines holding both
+	Indented      bool   // whether nodes appear to be structured by indentation rather than braces
+
+	// Configs holds the configurations suggested by the guesses above, to be passed to Parse or NewParser.
+	Configs []Configuration
+}
+
+// Sniff reads up to the first 4096 bytes of r and guesses how the parser should be configured to read it. The guesses
+// are only heuristics and may be wrong, particularly for short inputs. Because Sniff reads from r, the input should be
+// parsed from the Reader in the result, which replays the bytes read. If r is a *bufio.Reader, its buffer is peeked
+// and r itself is returned to be read. An error is returned only if r could not be read.
+func Sniff(r Reader) (SniffResult, error) {
+	var res SniffResult
+	var prefix []byte
+	if br, ok := r.(*bufio.Reader); ok {
+		b, err := br.Peek(sniffLen)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return res, err
+		}
+		if res.BOM = bytes.HasPrefix(b, utf8BOM); res.BOM {
+			br.Discard(len(utf8BOM))
+		}
+		prefix, res.Reader = b, br
+	} else {
+		b := make([]byte, sniffLen)
+		n, err := io.ReadFull(r, b)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return res, err
+		}
+		prefix = b[:n]
+		res.BOM = bytes.HasPrefix(prefix, utf8BOM)
+		rest := prefix
+		if res.BOM {
+			rest = prefix[len(utf8BOM):]
+		}
+		res.Reader = bufio.NewReader(io.MultiReader(bytes.NewReader(rest), r))
+	}
+
+	if res.BOM {
+		prefix = prefix[len(utf8BOM):]
+	}
+	if len(prefix) >= sniffLen-len(utf8BOM) {
+		// Ignore the last line, which may have been cut short.
+		if i := bytes.LastIndexAny(prefix, "\r\n"); i != -1 {
+			prefix = prefix[:i+1]
+		}
+	}
+	res.sniff(prefix)
+	return res, nil
+}
+
+// sniff makes the guesses held by res from the lines of b.
+func (res *SniffResult) sniff(b []byte) {
+	res.UTF8 = utf8.Valid(b)
+	res.ASCII = true
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			res.ASCII = false
+			break
+		}
+	}
+
+	// Lines ending in a lone '\r' are split as though they ended in '\n'.
+	lf := bytes.Count(b, []byte{'\n'})
+	if cr := bytes.Count(b, []byte{'\r'}) - bytes.Count(b, []byte("\r\n")); cr > lf {
+		res.CR = true
+		b = bytes.ReplaceAll(b, []byte{'\r'}, []byte{'\n'})
+	}
+
+	var lines, crlf, values int
+	var indents, braces bool
+	ops := make(map[rune]int)
+	prevIndent := -1
+	for _, line := range bytes.SplitAfter(b, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		lines++
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			crlf++
+		}
+		braces = braces || bytes.ContainsAny(line, "{}")
+
+		text := bytes.TrimLeft(line, " \t")
+		indent := len(line) - len(text)
+		text = bytes.TrimRight(text, " \t\r\n")
+		if len(text) == 0 {
+			continue
+		}
+		if text[0] == '#' {
+			res.Comments = true
+			continue
+		}
+		if prevIndent != -1 && indent > prevIndent {
+			indents = true
+		}
+		prevIndent = indent
+
+		// Find the rune following the first word of the line, skipping whitespace.
+		key := bytes.IndexAny(text, " \t=:")
+		if key <= 0 {
+			continue
+		}
+		rest := bytes.TrimLeft(text[key:], " \t")
+		if len(rest) == 0 {
+			continue
+		}
+		values++
+		if rest[0] == '=' || rest[0] == ':' {
+			ops[rune(rest[0])]++
+		}
+	}
+
+	res.CRLF = lines > 0 && crlf*2 > lines
+	res.Indented = indents && !braces
+	for _, op := range []rune{'=', ':'} {
+		if ops[op]*2 > values {
+			res.AssignmentOps = append(res.AssignmentOps, op)
+		}
+	}
+
+	if res.CR {
+		res.Configs = append(res.Configs, NormalizeLineEndings(true))
+	}
+	if res.Comments {
+		res.Configs = append(res.Configs, ReadComments(true))
+	}
+	if len(res.AssignmentOps) > 0 {
+		res.Configs = append(res.Configs, AssignmentOps(res.AssignmentOps))
+	}
+	if res.Indented {
+		res.Configs = append(res.Configs, IndentStructure(true))
+	}
+}
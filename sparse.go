@@ -43,6 +43,11 @@
 //      Field{"grid", "1 1 1\n1 1 1\n1 1 1"
 //      NodeLeave(1)
 //
+// A '{' only enters a node if it is the first rune following a key, other than whitespace, as in "next-line-brace"
+// above. Once a value has begun, braces are read as part of it, so "key value{more}" and "key value {" are both fields,
+// with the values "value{more}" and "value {". Within a node, a '}' in a value leaves the node unless it closes a '{'
+// earlier in the same value. A value may begin with a literal brace, or hold an unmatched one, by escaping it as "\{"
+// or "\}", as an Encoder does. A '}' doesn't end its line, so "a { x 1 } b { y 2 }" holds two sibling nodes.
 package sparse
 
 // TODO(nilium): Need to write up-to-date / correct documentation since this is a renovation of an older package.
@@ -51,25 +56,131 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"sort"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
+// Parser reads pieces from a Reader. A Parser is not safe for concurrent use, though separate Parsers may be used at
+// once by separate goroutines.
 type Parser struct {
 	readComments           bool
 	keepSeqWhitespace      bool
+	uncompressed           map[string]bool
+	literalHash            map[string]bool // keys whose values may hold '#', if LiteralHashKeys is set
 	keepTrailingWhitespace bool
+	trimNodeNames          bool
+	docComments            bool
+	negationPrefix         bool
+	onNodeComplete         func(*Node) error
+	isSpace                func(rune) bool
+	customSpace            bool // whether isSpace was set by a SpaceFunc
+	defines                map[string]bool
+	namedLeaves            bool
+	wrapRoot               bool
+	keepTerminators        bool
+	filter                 func(rune) (rune, bool)
+	richPieces             bool
+	positionalNodeValues   bool
+	indentStructure        bool
+	join                   ContinuationJoin
+	recover                bool
+	singleDocument         bool
+	assignOps              []rune
+	mergeComments          bool
+	errorPieces            bool
+	budget                 int
+	keyWords               int
+	trimLeading            bool
+	valueTerms             []rune // runes ending values, if ValueTerminators is set
+	quotedNames            bool
+	onDirective            func(name, args string) error
+	maxPieces              int
+	rejectEmptyKeys        bool
+	onDepthChange          func(oldDepth, newDepth int)
+	paragraphValues        bool
+	tabStop                int
+	maxKeyLen              int
+	base64Blobs            bool
+	recoverTo              RecoverTo
+	initialState           State
+	normalizeLineEndings   bool
+	verbatimBlocks         bool
+	nodesOnly              bool
+	fieldDepth             bool
+	configs                []Configuration // configurations applied by the last Reset, for ResetKeep
 
-	depth int
-	next  parser
-	buf   bytes.Buffer
+	depth       int
+	next        parser
+	buf         bytes.Buffer
+	negated     bool        // whether the current key was negated
+	positional  bool        // whether the current field is a positional value, if positionalNodeValues is set
+	keyLiteral  int         // length of the current key up to its last escaped rune
+	keyEscaped  bool        // whether the current key begins with an escaped rune
+	words       int         // words read of the current key
+	tree        treeBuilder // nodes accumulated for onNodeComplete
+	sections    []section   // open conditional sections
+	names       []string    // names of open nodes, if namedLeaves is set
+	rootEntered bool        // whether the implicit root has been entered, if wrapRoot is set
+	rootLeft    bool        // whether the implicit root has been left, if wrapRoot is set
+	unread      []unread    // runes to be read again, last first
+
+	// State for indentStructure.
+	indent     []byte     // indentation of the current line
+	lineStart  bool       // whether the current key is the first thing on its line
+	lineIndent string     // indentation of the current key's line, if lineStart is set
+	indentChar byte       // the rune used for indentation, once known
+	indents    []string   // indentation of each open node
+	queue      []indented // pieces to be returned by Read
+	held       []indented // a field that may name a node, followed by comments
+	indentErr  error      // error to return once the queue is empty
+
+	errs         []error // syntax errors skipped, if recover is set
+	documentDone bool    // whether the first top-level node has been left, if singleDocument is set
+	runes        int     // runes read by the current call to Read, if budget is set
+	merge        *merge  // a comment being merged with the comments following it, if mergeComments is set
+	feed         feedReader
+	cr           bool // whether the last rune read was a '\r' read as '\n', if normalizeLineEndings is set
+	pieces       int  // pieces read, if maxPieces is set
+
+	peek [memPeekLen]byte // input inspected by readRun, if read from a memReader
+
+	commentInline bool       // whether the comment last read follows other content on its line
+	ahead         *lookahead // the piece read after a comment merged by mergeComments
+
+	pos   Position // position of the next rune
+	last  Position // position of the last rune read
+	start Position // position of the current piece
+	end   Position // position following the current piece
+
+	lastContent Position // position following the last non-space rune read
+	prevContent Position // lastContent before the last rune read
+	termAhead   bool     // whether the last rune read begins the piece following the current one
+
+	line        []byte // the end of the current line read so far, for error snippets
+	lineContent bool   // whether a non-space rune has been read on the current line
+	inline      bool   // whether the last rune read was preceded by a non-space rune on its line
 }
 
+// Reset discards the parser's state and configuration, and then applies configs to it, so that it reads a new input
+// as a Parser returned by NewParser(configs...) would. Configurations given to earlier calls to Reset or NewParser are
+// not retained. Use ResetKeep to read a new input with the same configuration.
 func (p *Parser) Reset(configs ...Configuration) {
 	p.buf.Reset()
-	*p = Parser{buf: p.buf}
-	for _, cfg := range configs {
+	*p = Parser{buf: p.buf, pos: Position{Line: 1, Column: 1}, configs: append([]Configuration(nil), configs...)}
+	for _, cfg := range p.configs {
 		cfg.apply(p)
 	}
+	if p.isSpace == nil {
+		p.isSpace = unicode.IsSpace
+	}
+}
+
+// ResetKeep discards the parser's state, including its depth, position, any partly read piece, and any input given to
+// Feed, so that it reads a new input with the configuration given to the last call to Reset or NewParser.
+func (p *Parser) ResetKeep() {
+	p.Reset(p.configs...)
 }
 
 type bytesReader interface {
@@ -110,23 +221,290 @@ func NewParser(configs ...Configuration) *Parser {
 	return p
 }
 
-func Parse(r Reader, configs ...Configuration) (pieces []Piece, err error) {
+// Document is a sequence of pieces read from a single input.
+type Document []Piece
+
+// Balanced reports whether every node entered in d is also left, and no node is left without first being entered.
+func (d Document) Balanced() bool {
+	depth := 0
+	for _, piece := range d {
+		switch piece.Kind() {
+		case KindNodeEnter:
+			depth++
+		case KindNodeLeave:
+			if depth--; depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+// AutoClose returns d with a NodeLeave appended for each node left open at its end, deepest first, such as when d was
+// read from truncated input. If d contains NamedNodeLeave pieces, NamedNodeLeave pieces are appended instead. AutoClose
+// does not remove leaves without matching enters, so its result may still not be balanced.
+func (d Document) AutoClose() Document {
+	var names []string
+	var named bool
+	for _, piece := range d {
+		if name, ok := enterName(piece); ok {
+			names = append(names, name)
+		} else if _, ok := leaveDepth(piece); ok && len(names) > 0 {
+			names = names[:len(names)-1]
+		}
+		if _, ok := piece.(NamedNodeLeave); ok {
+			named = true
+		}
+	}
+
+	d = d[:len(d):len(d)]
+	for depth := len(names); depth > 0; depth-- {
+		if named {
+			d = append(d, NamedNodeLeave{NodeLeave(depth), names[depth-1]})
+		} else {
+			d = append(d, NodeLeave(depth))
+		}
+	}
+	return d
+}
+
+// FixDepths returns a copy of d with the depth of each NodeLeave, and NamedNodeLeave, set to the depth of the node it
+// leaves, counting the nodes entered and left before it. Leaves without a matching enter are kept as-is. FixDepths
+// treats the implicit root read with WrapRoot as an ordinary node, so a Document read with WrapRoot is renumbered as if
+// its root were a top-level node.
+func (d Document) FixDepths() Document {
+	fixed := make(Document, len(d))
+	depth := 0
+	for i, piece := range d {
+		switch piece := piece.(type) {
+		case NodeLeave:
+			if depth > 0 {
+				fixed[i] = NodeLeave(depth)
+				depth--
+				continue
+			}
+		case NamedNodeLeave:
+			if depth > 0 {
+				piece.NodeLeave = NodeLeave(depth)
+				fixed[i] = piece
+				depth--
+				continue
+			}
+		default:
+			if piece.Kind() == KindNodeEnter {
+				depth++
+			}
+		}
+		fixed[i] = piece
+	}
+	return fixed
+}
+
+// Parse reads all pieces from r and returns them as a Document. Reaching the end of r is not an error, so input holding
+// only whitespace and comments parses to an empty Document, or one holding only comments if ReadComments is set, with
+// a nil error. If an error occurs, the pieces read before it are returned along with it. If Recover is set, any
+// syntax errors skipped are returned as a MultiError once all of r has been read.
+func Parse(r Reader, configs ...Configuration) (Document, error) {
+	return parse(r, nil, configs)
+}
+
+// ParseConcurrent parses each of the named readers with Parse, in its own goroutine, and returns the Document read
+// from each by name. If any parse fails, the errors are returned as ReaderErrors along with the Documents of all
+// readers, including the pieces read from failed readers before their errors. Since the readers are parsed
+// concurrently, any OnNodeComplete callback given must be safe for concurrent use.
+func ParseConcurrent(readers map[string]Reader, configs ...Configuration) (map[string]Document, error) {
+	type result struct {
+		name string
+		doc  Document
+		err  error
+	}
+	results := make(chan result, len(readers))
+	for name, r := range readers {
+		go func(name string, r Reader) {
+			doc, err := Parse(r, configs...)
+			results <- result{name, doc, err}
+		}(name, r)
+	}
+
+	docs := make(map[string]Document, len(readers))
+	var errs ReaderErrors
+	for range readers {
+		res := <-results
+		docs[res.name] = res.doc
+		if res.err != nil {
+			if errs == nil {
+				errs = make(ReaderErrors)
+			}
+			errs[res.name] = res.err
+		}
+	}
+	if errs != nil {
+		return docs, errs
+	}
+	return docs, nil
+}
+
+// ReaderErrors maps the names of readers given to ParseConcurrent to the errors encountered parsing them.
+type ReaderErrors map[string]error
+
+func (e ReaderErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = name + ": " + e[name].Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ParseChan reads all pieces from r, as Parse does, and sends each on ch as it is read, closing ch once r has been read
+// or an error occurs. Each send blocks until the piece is received, so the parse proceeds only as fast as pieces are
+// consumed. Errors are returned by ParseChan rather than sent on ch: since ch is closed on error as well as at the end
+// of input, consumers that need to tell the two apart must also wait for ParseChan to return.
+func ParseChan(r Reader, ch chan<- Piece, configs ...Configuration) error {
+	defer close(ch)
+	var p Parser
+	p.Reset(configs...)
+	for {
+		piece, err := p.Read(r)
+		if err == ErrWouldBlock {
+			continue
+		} else if err != nil {
+			return p.parseErr(err)
+		}
+		ch <- piece
+	}
+}
+
+// ParseN parses only the first n top-level nodes of r, along with any top-level fields and comments preceding the
+// last of them, and stops reading once the nth node is left. If r holds fewer than n top-level nodes, ParseN parses
+// all of it, as Parse does. Stopping early is not an error.
+func ParseN(r Reader, n int, configs ...Configuration) (Document, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	return parse(r, func(_ *Parser, piece Piece) bool {
+		if depth, ok := leaveDepth(piece); ok && depth == 1 {
+			n--
+		}
+		return n == 0
+	}, configs)
+}
+
+// Extract parses r only as far as needed to return the pieces of the first node found at the given path of node names,
+// including the pieces entering and leaving it. The first name in path is that of a top-level node. Nodes not along the
+// path are skipped over without being retained. If no node is found at path, Extract returns a nil Document.
+func Extract(r Reader, path []string, configs ...Configuration) (Document, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	var p Parser
+	p.Reset(configs...)
+	var doc Document
+	matched := 0 // number of names in path matched by open nodes
+	for {
+		piece, err := p.Read(r)
+		if err == io.EOF {
+			return doc, nil
+		} else if err == ErrWouldBlock {
+			continue
+		} else if err != nil {
+			return doc, err
+		}
+
+		if doc != nil {
+			doc = append(doc, piece)
+			if p.depth < len(path) {
+				return doc, nil
+			}
+			continue
+		}
+
+		if name, ok := enterName(piece); ok && p.depth > 0 {
+			if p.depth != matched+1 || name != path[matched] {
+				if err := p.SkipNode(r); err != nil && err != io.EOF {
+					return nil, err
+				}
+				continue
+			}
+			if matched++; matched == len(path) {
+				doc = Document{piece}
+			}
+		} else if p.depth < matched {
+			matched = p.depth
+		}
+	}
+}
+
+// ParseWithPositions parses r as Parse does, and also returns the position at which each piece of the Document
+// begins, such that positions[i] is the position of the Document's ith piece.
+func ParseWithPositions(r Reader, configs ...Configuration) (doc Document, positions []Position, err error) {
+	doc, err = parse(r, func(p *Parser, _ Piece) bool {
+		positions = append(positions, p.Pos())
+		return false
+	}, configs)
+	return doc, positions, err
+}
+
+// ParseSpans parses r as Parse does, and also returns the span of the input holding each piece of the Document, such
+// that spans[i] is the span of the Document's ith piece, for use with PieceAt.
+func ParseSpans(r Reader, configs ...Configuration) (doc Document, spans []Span, err error) {
+	doc, err = parse(r, func(p *Parser, _ Piece) bool {
+		spans = append(spans, Span{p.Pos(), p.End()})
+		return false
+	}, configs)
+	return doc, spans, err
+}
+
+// PieceAt returns the piece of d whose span contains the byte at offset, given the spans of d's pieces returned by
+// ParseSpans. It returns false if offset falls between pieces, such as in whitespace, or outside of d. PieceAt takes
+// the spans as an argument because a Document holds only its pieces and doesn't record where they were read from. A
+// piece's span ends after its last rune of content, so the newline ending a line, and any space before it, belong to no
+// piece.
+func (d Document) PieceAt(spans []Span, offset int) (Piece, bool) {
+	i := sort.Search(len(spans), func(i int) bool { return spans[i].Start.Offset > offset }) - 1
+	if i < 0 || i >= len(d) || !spans[i].Contains(offset) {
+		return nil, false
+	}
+	return d[i], true
+}
+
+// parse reads pieces from r until EOF or, if fn is not nil, until fn returns true for the last piece read.
+func parse(r Reader, fn func(*Parser, Piece) bool, configs []Configuration) (pieces Document, err error) {
 	var p Parser
 	p.Reset(configs...)
 
 	for err == nil {
 		var piece Piece
-		piece, err = p.Read(r)
-		if err == nil {
+		if piece, err = p.Read(r); err == ErrWouldBlock {
+			err = nil
+		} else if err == nil {
 			pieces = append(pieces, piece)
+			if fn != nil && fn(&p, piece) {
+				break
+			}
 		}
 	}
 
+	return pieces, p.parseErr(err)
+}
+
+// parseErr returns the error to return from parsing all of the parser's input, given the error that stopped it: nil
+// at the end of input, and otherwise err, along with any syntax errors skipped, as a MultiError.
+func (p *Parser) parseErr(err error) error {
 	if err == io.EOF {
 		err = nil
 	}
-
-	return pieces, err
+	if errs := p.Errors(); err != nil && len(errs) > 0 {
+		err = append(MultiError(errs), err)
+	} else if len(errs) > 0 {
+		err = MultiError(errs)
+	}
+	return err
 }
 
 type parser interface {
@@ -143,33 +521,62 @@ func (p *Parser) comment(comment string, next parser) parser {
 	})
 }
 
+// readComment returns a parser that reads a comment following the comment character last read.
 func (p *Parser) readComment(next parser) parser {
-	return readFn(func(r Reader) (parser, Piece, error) {
-		comment, err := readUntil(r, '\n')
+	start, inline := p.last, p.inline
+	var read parser
+	read = readFn(func(r Reader) (parser, Piece, error) {
+		p.start, p.commentInline = start, inline
+		c, _, err := p.readRune(r)
+		for c != '\n' && err == nil {
+			p.buf.WriteRune(c)
+			c, _, err = p.readRune(r)
+		}
+		if err == ErrWouldBlock {
+			return read, nil, err
+		}
+		comment := p.buf.Bytes()
+		p.buf.Reset()
+		end := p.pos
 		if err == nil {
-			// chomp line ending
-			comment = comment[:len(comment)-1]
+			end = p.last
 		}
-
-		if err != nil && err != io.EOF {
-			// If err isn't nil post-comment read, then nullify the
-			// next read function
-			next = errReader{err}
+		if n := len(comment); n > 0 && comment[n-1] == '\r' {
+			comment = comment[:n-1]
+			end.Offset, end.Column = end.Offset-1, end.Column-1
 		}
 
 		var piece Piece
-		if p.readComments {
+		if p.docComments && p.readComments {
+			piece = DocComment{Text: string(comment), Pos: start, End: end, Inline: inline}
+		} else if p.readComments {
 			piece = Comment(string(comment))
 		}
 
+		if err != nil && err != io.EOF {
+			// Nothing can be read past the error, so don't continue to next.
+			return errReader{err}, piece, err
+		}
+
 		return next, piece, err
 	})
+	return read
 }
 
 func (p *Parser) readKey(r Reader) (parser, Piece, error) {
-	c, _, err := r.ReadRune()
-	for (c == ' ' || c == '\t' || c == '\n' || c == '\r') && err == nil {
-		c, _, err = r.ReadRune()
+	c, _, err := p.readRune(r)
+	for p.space(c) && err == nil {
+		c, _, err = p.readRune(r)
+	}
+	if err == ErrWouldBlock {
+		return readFn(p.readKey), nil, err
+	}
+	p.start = p.last
+	p.negated, p.positional = false, false
+	p.keyLiteral, p.keyEscaped = 0, false
+	p.words = 1
+	if p.indentStructure {
+		p.markIndent()
 	}
 
 	if err != nil && err != io.EOF {
@@ -182,59 +589,92 @@ func (p *Parser) readKey(r Reader) (parser, Piece, error) {
 		return p.enter("")
 	} else if c == '#' {
 		return p.readComment(readFn(p.readKey)), nil, nil
+	} else if c == '!' && p.negationPrefix {
+		p.negated = true
+		return p.readKeyStart().read(r)
 	}
 
-	var escape bool
-	var last rune
-	for !(!escape && (c == ' ' || c == '!' || c == ';' || c == '\t' || c == '\n' || c == '\r' || c == '#')) && err == nil {
-		if c == '\r' {
-			goto skipWrite
+	return p.readKeyToken(r, c, err)
+}
+
+// readKeyStart returns a parser that reads the key beginning with the next rune.
+func (p *Parser) readKeyStart() parser {
+	var read parser
+	read = readFn(func(r Reader) (parser, Piece, error) {
+		c, _, err := p.readRune(r)
+		if err == ErrWouldBlock {
+			return read, nil, err
 		}
+		return p.readKeyToken(r, c, err)
+	})
+	return read
+}
 
-		if !escape && c == '\\' {
-			escape = true
-			goto skipWrite
-		} else if escape {
-			if c == '\n' {
-				if !p.keepSeqWhitespace {
-					chompBuffer(&p.buf)
+// readKeyToken reads the key beginning with c and the error read with it.
+func (p *Parser) readKeyToken(r Reader, c rune, err error) (parser, Piece, error) {
+	if c == '"' && p.quotedNames && err == nil {
+		return p.readQuoted(), nil, nil
+	}
+	return p.readToken(r, c, err, &token{isKey: true, compress: !p.keepSeqWhitespace}, p.readKeyEnd)
+}
+
+// readQuoted returns a parser that reads a key quoted by the '"' last read, as permitted by QuotedNames.
+func (p *Parser) readQuoted() parser {
+	start := p.last
+	var escape, closed bool
+	var read parser
+	read = readFn(func(r Reader) (parser, Piece, error) {
+		c, n, err := p.readRune(r)
+		for !closed && err == nil {
+			if escape {
+				if c != '"' && c != '\\' {
+					p.buf.WriteByte('\\')
 				}
+				p.buf.WriteRune(c)
+				escape = false
+			} else if c == '\\' {
+				escape = true
+			} else if c == '"' {
+				closed = true
 			} else {
-				switch c {
-				case 't':
-					c = '\t'
-				case 'n':
-					c = '\n'
-				case 'r':
-					c = '\r'
-				case 'b':
-					c = '\b'
-				case 'f':
-					c = '\f'
-				case '0':
-					c = rune(0)
-				case 'v':
-					c = '\v'
-				}
+				p.buf.WriteRune(c)
 			}
-			escape = false
-			goto skipCompressCheck
-		} else if c == '\r' {
-			goto skipWrite
+			if err := p.checkKeyLen(); err != nil {
+				return errReader{err}, nil, err
+			}
+			c, n, err = p.readRune(r)
 		}
 
-		if !p.keepSeqWhitespace && unicode.IsSpace(last) && unicode.IsSpace(c) {
-			goto skipWrite
+		if err == ErrWouldBlock {
+			return read, nil, err
+		} else if !closed {
+			p.buf.Reset()
+			if err == io.EOF {
+				err = &ParseError{Pos: start, Err: ErrUnclosedQuote}
+			}
+			return errReader{err}, nil, err
 		}
 
-	skipCompressCheck:
-		last = c
-		p.buf.WriteRune(c)
-	skipWrite:
-		c, _, err = r.ReadRune()
+		// The quoted key is never trimmed or extended by KeyWords. Anything following the closing quote that wouldn't
+		// end a key is read again as if a space had ended it.
+		p.words = p.keyWords
+		if err == nil && !p.endsToken(c, true, 0) {
+			p.unreadRune(c, n)
+			c = ' '
+		}
+		return p.readKeyEnd(r, c, p.buf.Len(), err)
+	})
+	return read
+}
+
+// readKeyEnd returns the parser that follows a key, ended by c, and the field read if the key has no value.
+func (p *Parser) readKeyEnd(r Reader, c rune, literal int, err error) (parser, Piece, error) {
+	if err == nil && p.words < p.keyWords && c != '\n' && p.space(c) && !p.isDirective(p.buf.String()) {
+		return p.readKeyWord(c, literal), nil, nil
 	}
 
 	key := p.buf.String()
+	p.keyLiteral = literal
 	p.buf.Reset()
 	if len(key) == 0 && err != nil {
 		if err == io.EOF {
@@ -248,148 +688,570 @@ func (p *Parser) readKey(r Reader) (parser, Piece, error) {
 	var piece Piece
 	if err == io.EOF {
 		next = eofReader
-		piece = Field{key, ""}
+		piece = p.newField(key, "", 0)
+	} else if err != nil {
+		next = errReader{err}
+		piece = p.newField(key, "", 0)
 	} else if c == '#' {
-		next = p.readComment(next)
-		piece = Field{key, ""}
+		next = p.readComment(readFn(p.readKey))
+		piece = p.newField(key, "", 0)
+		p.termAhead = true
 	} else if c == '!' || c == ';' {
 		next = readFn(p.readKey)
-		piece = Field{key, ""}
+		piece = p.newField(key, "", c)
+	} else if c == '}' {
+		next = p.readLeave()
+		piece = p.newField(key, "", 0)
+		p.termAhead = true
+	} else if c == '\n' && p.endsAtLine(key) {
+		next = readFn(p.readKey)
+		piece = p.newField(key, "", 0)
 	} else {
-		next, piece, err = p.readValue(r, key)
+		next, piece, err = p.readValue(r, key, p.isAssignOp(c))
 	}
 
 	return next, piece, err
 }
 
+// readKeyWord returns a parser that reads the whitespace following a word of the current key, beginning with c, and
+// the next word of the key if one follows on the same line, as permitted by KeyWords. literal is the length of the key
+// up to its last escaped rune. If no word follows, the key ends at the last word read.
+func (p *Parser) readKeyWord(c rune, literal int) parser {
+	end := p.buf.Len()
+	sep := c
+	p.buf.WriteRune(c)
+	var read parser
+	read = readFn(func(r Reader) (parser, Piece, error) {
+		c, n, err := p.readRune(r)
+		for c != '\n' && p.space(c) && err == nil {
+			if p.keepSeqWhitespace {
+				p.buf.WriteRune(c)
+			}
+			c, n, err = p.readRune(r)
+		}
+		if err == ErrWouldBlock {
+			return read, nil, err
+		}
+
+		if err == nil && c != '{' && c != '}' && !p.endsToken(c, true, 0) {
+			p.words++
+			t := &token{isKey: true, compress: !p.keepSeqWhitespace, literal: literal}
+			return p.readToken(r, c, err, t, p.readKeyEnd)
+		}
+
+		// Return whatever followed the whitespace to be read again as if the key had ended at sep.
+		p.buf.Truncate(end)
+		p.words = p.keyWords
+		if err != nil {
+			p.unread = append(p.unread, unread{err: err})
+		} else {
+			p.unreadRune(c, n)
+		}
+		return p.readKeyEnd(r, sep, literal, nil)
+	})
+	return read
+}
+
 func (p *Parser) enter(key string) (parser, Piece, error) {
+	if p.trimNodeNames {
+		key = string(p.trimTrailingSpace([]byte(key), p.keyLiteral))
+	}
+	if p.negated {
+		// Negation only applies to fields, so restore the prefix.
+		key = "!" + key
+	}
+	if err := p.checkNodeName(key); err != nil {
+		return errReader{err}, nil, err
+	}
 	out := NodeEnter(key)
-	p.depth++
-	return readFn(p.readKey), out, nil
+	p.setDepth(p.depth + 1)
+	if p.namedLeaves {
+		p.names = append(p.names, key)
+	}
+	var next parser = readFn(p.readKey)
+	if p.positionalNodeValues {
+		next = p.readPositional()
+	}
+	if p.richPieces {
+		return p.readEnterComment(NodeEnterEx{NodeEnter: out, Pos: p.start}, next), nil, nil
+	}
+	return next, out, nil
+}
+
+// readPositional returns a parser that reads the rest of the line following the opening brace of a node as a
+// positional field if the node is closed on the same line, and otherwise reads the node's contents as usual. The
+// runes of the line are read ahead and then returned to the parser to be read again.
+func (p *Parser) readPositional() parser {
+	var runes []unread
+	var start Position
+	var escape, content bool
+	var read parser
+	read = readFn(func(r Reader) (parser, Piece, error) {
+		c, n, err := p.readRune(r)
+		for err == nil {
+			runes = append(runes, unread{c: c, n: n, last: p.last, inline: p.inline})
+			if !content && !p.space(c) {
+				start, content = p.last, c != '}'
+			}
+			if escape {
+				escape = false
+			} else if c == '\\' {
+				escape = true
+			} else if c == '\n' || c == ';' || c == '#' || c == '{' || c == '}' {
+				break
+			}
+			c, n, err = p.readRune(r)
+		}
+
+		if err == ErrWouldBlock {
+			return read, nil, err
+		} else if err != nil {
+			p.unread = append(p.unread, unread{err: err})
+		}
+		for i := len(runes) - 1; i >= 0; i-- {
+			p.unread = append(p.unread, runes[i])
+		}
+		if err != nil || c != '}' || !content {
+			return p.readKey(r)
+		}
+
+		p.start, p.negated, p.positional = start, false, true
+		return p.readValue(r, "", true)
+	})
+	return read
+}
+
+// readEnterComment returns a parser that reads any comment following the opening brace of a node on the same line,
+// attaches it to enter, and returns enter. If no comment or line ending follows the brace, next reads the rest of the
+// line.
+func (p *Parser) readEnterComment(enter NodeEnterEx, next parser) parser {
+	var comment bool // whether the comment's '#' has been read
+	var read parser
+	read = readFn(func(r Reader) (parser, Piece, error) {
+		if !comment {
+			c, n, err := p.readRune(r)
+			for c != '\n' && p.space(c) && err == nil {
+				c, n, err = p.readRune(r)
+			}
+			if err == ErrWouldBlock {
+				return read, nil, err
+			} else if err != nil && err != io.EOF {
+				return errReader{err}, enter, err
+			} else if err != nil || c == '\n' {
+				return readFn(p.readKey), enter, err
+			} else if c != '#' {
+				p.unreadRune(c, n)
+				return next, enter, nil
+			}
+			comment = true
+		}
+
+		c, _, err := p.readRune(r)
+		for c != '\n' && err == nil {
+			p.buf.WriteRune(c)
+			c, _, err = p.readRune(r)
+		}
+		if err == ErrWouldBlock {
+			return read, nil, err
+		}
+		enter.Comment = string(bytes.TrimSuffix(p.buf.Bytes(), []byte{'\r'}))
+		p.buf.Reset()
+		if err != nil && err != io.EOF {
+			return errReader{err}, enter, err
+		}
+		return readFn(p.readKey), enter, err
+	})
+	return read
 }
 
+// readLeave returns a parser that leaves the current node at the closing brace last read.
+func (p *Parser) readLeave() parser {
+	start := p.last
+	return readFn(func(Reader) (parser, Piece, error) {
+		p.start = start
+		return p.leave()
+	})
+}
+
+// ErrUnexpectedNodeLeave is returned when a node is left that was never entered. The parser returns it as a
+// *ParseError with a Snippet of the line holding the closing brace.
 var ErrUnexpectedNodeLeave = errors.New("sparse: unexpected end of node")
 
+// ErrTrailingContent is returned, as a *ParseError, when SingleDocument is set and anything other than a comment
+// follows the first top-level node.
+var ErrTrailingContent = errors.New("sparse: content after end of document")
+
+// ErrTooManyPieces is returned, as a *ParseError, when more pieces are read than permitted by MaxPieces.
+var ErrTooManyPieces = errors.New("sparse: too many pieces")
+
+// ErrUnclosedQuote is returned, as a *ParseError, when the input ends within a key quoted by QuotedNames.
+var ErrUnclosedQuote = errors.New("sparse: unclosed quoted name")
+
+// ErrKeyTooLong is returned, as a *ParseError, when a key is longer than permitted by MaxKeyLen.
+var ErrKeyTooLong = errors.New("sparse: key too long")
+
+// ErrEmptyKey is returned, as a *ParseError, when a field with an empty key is read while RejectEmptyKeys is set. It is
+// also returned by an Encoder asked to write a field with a value but no key, which would not be read back as the same
+// field.
+var ErrEmptyKey = errors.New("sparse: empty key")
+
+// ErrInvalidNodeName is returned, as a *ParseError, when a node name contains a newline while whitespace is being
+// compressed.
+var ErrInvalidNodeName = errors.New("sparse: newline in node name")
+
+// checkNodeName returns an error if name may not be used as the name of a node. Newlines are only permitted in names if
+// CompressWhitespace is disabled.
+func (p *Parser) checkNodeName(name string) error {
+	if !p.keepSeqWhitespace && strings.ContainsRune(name, '\n') {
+		return &ParseError{Pos: p.start, Err: ErrInvalidNodeName}
+	}
+	return nil
+}
+
+// leave leaves the current node and returns the parser reading the key that follows, which may be on the same line as
+// the closing brace.
 func (p *Parser) leave() (parser, Piece, error) {
 	if p.depth == 0 {
-		return errReader{ErrUnexpectedNodeLeave}, nil, ErrUnexpectedNodeLeave
+		err := &ParseError{Pos: p.start, Err: ErrUnexpectedNodeLeave, Snippet: p.snippet()}
+		return errReader{err}, nil, err
 	}
-	out := NodeLeave(p.depth)
-	p.depth--
+	var out Piece = NodeLeave(p.depth)
+	if p.namedLeaves {
+		out = NamedNodeLeave{NodeLeave(p.depth), p.names[len(p.names)-1]}
+		p.names = p.names[:len(p.names)-1]
+	}
+	p.setDepth(p.depth - 1)
 	return readFn(p.readKey), out, nil
 }
 
-func (p *Parser) field(key, value string, next parser) parser {
-	return readFn(func(r Reader) (parser, Piece, error) {
-		return next, Field{key, value}, nil
-	})
+// setDepth sets the parser's depth, passing the change to its OnDepthChange callback.
+func (p *Parser) setDepth(depth int) {
+	old := p.depth
+	p.depth = depth
+	if p.onDepthChange != nil {
+		p.onDepthChange(old, depth)
+	}
 }
 
-func chompBuffer(b *bytes.Buffer) {
-	n := b.Len()
-	bs := b.Bytes()
-	for ; n > 0; n-- {
-		c := rune(bs[n-1])
-		if c == '\n' || !unicode.IsSpace(rune(bs[n-1])) {
-			break
-		}
-	}
-	if b.Len() != n {
-		b.Truncate(n)
+// checkKeyLen returns ErrKeyTooLong, as a *ParseError, if the key in the parser's buffer is longer than permitted by
+// MaxKeyLen. The buffer is discarded if so.
+func (p *Parser) checkKeyLen() error {
+	if p.maxKeyLen <= 0 || p.buf.Len() <= p.maxKeyLen {
+		return nil
 	}
+	p.buf.Reset()
+	return &ParseError{Pos: p.start, Err: ErrKeyTooLong}
 }
 
-// readValue attempts to read a value from the given Reader and returns
-// the next read function or an error.
-func (p *Parser) readValue(r Reader, key string) (parser, Piece, error) {
-	c, _, err := r.ReadRune()
-	for (c == ' ' || c == '\t' || c == '\n' || c == '\r') && err == nil {
-		c, _, err = r.ReadRune()
-	}
+// emptyKey reports whether piece is a field with an empty key that is not a positional value.
+func (p *Parser) emptyKey(piece Piece) bool {
+	f, ok := fieldOf(piece)
+	return ok && f.Key == "" && !p.positional
+}
 
-	if err != nil && err != io.EOF {
-		return errReader{err}, nil, err
+// newField returns the piece for a field read with the given key and value, ended by term.
+func (p *Parser) newField(key, value string, term rune) Piece {
+	if !p.negationPrefix && !p.keepTerminators && !p.fieldDepth {
+		return Field{key, value}
 	}
 
-	if c == '{' {
-		return p.enter(key)
-	} else if c == '#' {
-		return p.readComment(readFn(p.readKey)), Field{key, ""}, nil
+	f := FieldEx{Field: Field{key, value}, Negated: p.negated}
+	if p.keepTerminators {
+		f.Terminator, f.TerminatorKept = term, true
+	}
+	if p.fieldDepth {
+		f.Depth = p.depth
 	}
+	return f
+}
 
-	defer p.buf.Reset()
-	var escape bool
-	var last rune
-	for !(!escape && (c == '\n' || c == ';' || c == '#')) && err == nil {
+func (p *Parser) field(key, value string, next parser) parser {
+	return readFn(func(r Reader) (parser, Piece, error) {
+		return next, Field{key, value}, nil
+	})
+}
+
+// space reports whether c is whitespace, according to the parser's SpaceFunc. Line endings are always whitespace.
+func (p *Parser) space(c rune) bool {
+	return c == '\n' || c == '\r' || p.isSpace(c)
+}
+
+// trimTrailingSpace trims trailing whitespace from b, leaving the first keep bytes, which end in an escaped rune,
+// as-is. Trailing whitespace is trimmed from values and, if TrimNodeNames is set, node names.
+func (p *Parser) trimTrailingSpace(b []byte, keep int) []byte {
+	return b[:keep+len(bytes.TrimRightFunc(b[keep:], p.space))]
+}
+
+// token is the state of a key or value being read by readToken.
+type token struct {
+	isKey    bool
+	compress bool
+	escape   bool
+	last     rune
+	braces   int  // unclosed braces in a value
+	literal  int  // length of the token up to its last escaped rune
+	hash     bool // whether a '#' is read as part of a value, if its key is listed by LiteralHashKeys
+}
+
+// readToken reads a key, if t.isKey is set, or a value into the parser's buffer, beginning with c and the error read
+// with it. Escapes are decoded and, if t.compress is set, runs of whitespace are compressed to their first rune. Once
+// the token ends, it returns the parser returned by done, which is passed the rune that ended the token, the length of
+// the token up to its last escaped rune, and any error. If the parser's ReadBudget is spent first, it instead returns
+// a parser that continues reading the token and ErrWouldBlock.
+func (p *Parser) readToken(r Reader, c rune, err error, t *token,
+	done func(Reader, rune, int, error) (parser, Piece, error)) (parser, Piece, error) {
+	for err == nil && (t.escape || t.hash && c == '#' || !p.endsToken(c, t.isKey, t.braces)) {
 		if c == '\r' {
 			// Ignore entirely
 			goto skipWrite
 		}
 
-		if !escape {
-			if c == '\\' {
-				escape = true
-				goto skipWrite
-			} else if c == '#' {
-				break
-			}
-		} else if escape {
+		if t.escape {
+			t.escape = false
 			if c == '\n' {
-				if !p.keepSeqWhitespace {
-					chompBuffer(&p.buf)
+				if t.compress {
+					chompBuffer(&p.buf, p.space, t.literal)
+				}
+				switch p.join {
+				case JoinSpace:
+					c = ' '
+				case JoinNone:
+					// Skip the write, but compress the continued line's leading whitespace as if it had been made.
+					t.last = '\n'
+					goto skipWrite
 				}
 			} else {
-				switch c {
-				case 't':
-					c = '\t'
-				case 'n':
-					c = '\n'
-				case 'r':
-					c = '\r'
-				case 'b':
-					c = '\b'
-				case 'f':
-					c = '\f'
-				case '0':
-					c = rune(0)
-				case 'v':
-					c = '\v'
+				// Any other escaped rune, such as a '!' or space that would otherwise end a key, or a brace that would
+				// otherwise enter or leave a node, is kept as-is.
+				if e, ok := escapes[c]; ok {
+					c = e
+				}
+				if t.isKey && p.buf.Len() == 0 {
+					p.keyEscaped = true
 				}
+				t.literal = p.buf.Len() + utf8.RuneLen(c)
 			}
-			escape = false
 			goto skipCompressCheck
-		} else if c == '\r' {
+		}
+
+		if c == '\\' {
+			t.escape = true
 			goto skipWrite
+		} else if !t.isKey && c == '{' {
+			t.braces++
+		} else if !t.isKey && c == '}' && t.braces > 0 {
+			t.braces--
 		}
 
-		if !p.keepSeqWhitespace && unicode.IsSpace(last) && unicode.IsSpace(c) {
+		if t.compress && c == '\n' && p.space(t.last) && t.last != '\n' {
+			// Only a ParagraphValues line ending is kept in a value, and it's kept in place of the whitespace before it.
+			p.buf.Truncate(len(p.trimTrailingSpace(p.buf.Bytes(), t.literal)))
+			goto skipCompressCheck
+		} else if t.compress && p.space(t.last) && p.space(c) {
+			goto skipWrite
+		}
+
+		if c == '\t' && !t.isKey && p.tabStop > 0 {
+			// Expand the tab to the next tab stop following its column in the input.
+			n := p.tabStop - (p.last.Column-1)%p.tabStop
+			for i := 0; i < n; i++ {
+				p.buf.WriteByte(' ')
+			}
+			t.last = ' '
 			goto skipWrite
 		}
 
 	skipCompressCheck:
-		last = c
 		p.buf.WriteRune(c)
+		t.last = p.readRun(r, t.isKey, c)
+		if t.isKey && p.maxKeyLen > 0 {
+			if err := p.checkKeyLen(); err != nil {
+				return errReader{err}, nil, err
+			}
+		}
 	skipWrite:
-		c, _, err = r.ReadRune()
+		c, _, err = p.readRune(r)
+	}
+
+	if err == ErrWouldBlock {
+		return readFn(func(r Reader) (parser, Piece, error) {
+			c, _, err := p.readRune(r)
+			return p.readToken(r, c, err, t, done)
+		}), nil, err
+	}
+	return done(r, c, t.literal, err)
+}
+
+// isAssignOp reports whether c is an assignment operator permitted by AssignmentOps.
+func (p *Parser) isAssignOp(c rune) bool {
+	for _, op := range p.assignOps {
+		if c == op {
+			return true
+		}
+	}
+	return false
+}
+
+// endsToken reports whether an unescaped c, just read, ends a key, if isKey is set, or a value with the given number
+// of unclosed braces.
+func (p *Parser) endsToken(c rune, isKey bool, braces int) bool {
+	switch c {
+	case ';', '#':
+		if isKey || p.valueTerms == nil {
+			return true
+		}
+	case '}':
+		return p.depth > 0 && (isKey || braces == 0)
+	case '!':
+		return isKey
+	case '\n':
+		if !isKey && p.paragraphValues && !p.indentStructure && p.inline {
+			// Only a newline ending a blank line ends the value.
+			return false
+		}
+	}
+	if isKey && p.isAssignOp(c) {
+		return true
+	}
+	if isKey {
+		return p.space(c)
+	}
+	return p.endsValue(c)
+}
+
+// endsValue reports whether an unescaped c ends a value, other than by closing a node, according to the parser's
+// ValueTerminators.
+func (p *Parser) endsValue(c rune) bool {
+	if p.valueTerms == nil {
+		return c == '\n' || c == ';' || c == '#'
+	}
+	for _, term := range p.valueTerms {
+		if c == term {
+			return true
+		}
+	}
+	return false
+}
+
+// escapes maps the runes following a backslash in keys and values to the runes they are decoded as. Any other escaped
+// rune is read as-is.
+var escapes = map[rune]rune{
+	't': '\t',
+	'n': '\n',
+	'r': '\r',
+	'b': '\b',
+	'f': '\f',
+	'0': 0,
+	'v': '\v',
+}
+
+// Escapes returns a copy of the escapes recognized by the parser, mapping each rune that may follow a backslash to the
+// rune it is decoded as. Other escaped runes are read as-is, apart from an escaped line ending, which continues a key
+// or value on the next line.
+func Escapes() map[rune]rune {
+	m := make(map[rune]rune, len(escapes))
+	for k, v := range escapes {
+		m[k] = v
+	}
+	return m
+}
+
+// chompBuffer trims whitespace other than newlines from the end of b, leaving the first keep bytes, which end in an
+// escaped rune, as-is.
+func chompBuffer(b *bytes.Buffer, isSpace func(rune) bool, keep int) {
+	bs := b.Bytes()
+	n := len(bs)
+	for n > keep {
+		c, size := utf8.DecodeLastRune(bs[:n])
+		if c == '\n' || !isSpace(c) {
+			break
+		}
+		n -= size
+	}
+	if b.Len() != n {
+		b.Truncate(n)
+	}
+}
+
+// readValue attempts to read a value from the given Reader and returns
+// the next read function or an error. A '{' enters a node named by key only
+// if it begins the value; braces following other runes are read as part of
+// the value.
+//
+// If assigned is not set, a single assignment operator, as permitted by AssignmentOps, may precede the value.
+func (p *Parser) readValue(r Reader, key string, assigned bool) (parser, Piece, error) {
+	ends := p.endsAtLine(key)
+	c, _, err := p.readRune(r)
+	for p.space(c) && !(ends && c == '\n') && err == nil {
+		c, _, err = p.readRune(r)
+	}
+	if !assigned && err == nil && p.isAssignOp(c) {
+		assigned = true
+		c, _, err = p.readRune(r)
+		for p.space(c) && !(ends && c == '\n') && err == nil {
+			c, _, err = p.readRune(r)
+		}
+	}
+
+	if err == ErrWouldBlock {
+		return readFn(func(r Reader) (parser, Piece, error) {
+			return p.readValue(r, key, assigned)
+		}), nil, err
+	} else if err != nil && err != io.EOF {
+		return errReader{err}, nil, err
+	}
+
+	if c == '\n' && ends {
+		return readFn(p.readKey), p.newField(key, "", 0), nil
+	} else if c == '{' && p.verbatimBlocks {
+		return p.readBlockStart(key), nil, nil
+	} else if c == '{' {
+		return p.enter(key)
+	} else if c == '#' && p.endsValue(c) && !p.literalHash[key] {
+		p.termAhead = true
+		return p.readComment(readFn(p.readKey)), p.newField(key, "", 0), nil
+	} else if c == '}' && p.depth > 0 {
+		p.termAhead = true
+		return p.readLeave(), p.newField(key, "", 0), nil
 	}
 
+	tok := &token{compress: !p.keepSeqWhitespace && !p.uncompressed[key], hash: p.literalHash[key]}
+	return p.readToken(r, c, err, tok, func(r Reader, c rune, literal int, err error) (parser, Piece, error) {
+		return p.readValueEnd(key, c, literal, err)
+	})
+}
+
+// readValueEnd returns the parser that follows the value of key, ended by c, and the field read.
+func (p *Parser) readValueEnd(key string, c rune, literal int, err error) (parser, Piece, error) {
+	defer p.buf.Reset()
 	var next parser = readFn(p.readKey)
+	var term rune
 	if err == io.EOF {
 		next = eofReader
 	} else if c == '#' {
-		next = p.readComment(next)
+		next, p.termAhead = p.readComment(next), true
+	} else if c == '}' {
+		next, p.termAhead = p.readLeave(), true
+	} else if err == nil && c != '\n' {
+		term = c
 	}
 
 	var valueStr string
 	if p.buf.Len() > 0 {
+		value := p.buf.Bytes()
 		if !p.keepTrailingWhitespace {
-			valueStr = string(bytes.TrimRight(p.buf.Bytes(), " \n\t\r"))
-		} else {
-			valueStr = p.buf.String()
+			value = p.trimTrailingSpace(value, literal)
+		}
+		if p.trimLeading {
+			value = bytes.TrimLeftFunc(value, p.space)
 		}
+		valueStr = string(value)
+	}
+	if p.base64Blobs && key == blobDirective {
+		return p.readBlob(valueStr, next, err)
 	}
 
-	return next, Field{key, valueStr}, err
+	return next, p.newField(key, valueStr, term), err
 }
 
 type eofReaderImpl struct{}
@@ -404,13 +1266,216 @@ func (r errReader) read(Reader) (parser, Piece, error) {
 	return r, nil, r.err
 }
 
+// Read reads the next piece from r. If an error occurs after a piece has been read, the piece is returned and the
+// error is returned by the following call to Read. Read returns io.EOF once r is exhausted, and ErrWouldBlock if its
+// ReadBudget is spent before a piece is read.
 func (p *Parser) Read(r Reader) (piece Piece, err error) {
-	if p.next == nil {
+	p.runes = 0
+	if p.wrapRoot && !p.rootEntered {
+		// The implicit root doesn't change the parser's depth.
+		p.start, p.end, p.rootEntered = p.pos, p.pos, true
+		return NodeEnter(""), nil
+	}
+
+	for piece == nil && err == nil {
+		if p.indentStructure {
+			piece, err = p.readIndented(r)
+		} else {
+			piece, err = p.readPiece(r)
+		}
+		if p.rejectEmptyKeys && piece != nil && p.emptyKey(piece) {
+			piece, err = nil, &ParseError{Pos: p.start, Err: ErrEmptyKey, Snippet: p.snippet()}
+		}
+		if p.recoverable(err) {
+			// The rest of the line can't be trusted, so skip past it.
+			p.next, err = p.skipError(p.skip(err), err), nil
+			continue
+		}
+		if piece != nil && (p.defines != nil || p.onDirective != nil) {
+			piece, err = p.preprocess(piece)
+			if p.recoverable(err) {
+				piece, err = p.skip(err), nil
+			}
+		}
+		if p.nodesOnly && piece != nil && (piece.Kind() == KindField || piece.Kind() == KindComment) {
+			piece = nil
+		}
+	}
+
+	if err == io.EOF && len(p.sections) > 0 {
+		err = &ParseError{Pos: p.sections[len(p.sections)-1].pos, Err: ErrMissingEndif}
+		if p.recover {
+			p.sections = nil
+			if piece = p.skip(err); piece != nil {
+				err = nil
+			} else {
+				err = io.EOF
+			}
+		}
+	}
+	if err == ErrWouldBlock {
+		return nil, err
+	} else if err != nil {
+		p.next = errReader{err}
+	}
+
+	if p.wrapRoot && !p.rootLeft && err == io.EOF {
+		p.start, p.end, p.rootLeft = p.pos, p.pos, true
+		if p.namedLeaves {
+			return NamedNodeLeave{NodeLeave(0), ""}, nil
+		}
+		return NodeLeave(0), nil
+	}
+
+	if piece != nil && p.singleDocument {
+		if p.documentDone && piece.Kind() != KindComment {
+			err = &ParseError{Pos: p.start, Err: ErrTrailingContent}
+			p.next, piece = errReader{err}, nil
+		} else if depth, ok := leaveDepth(piece); ok && depth == 1 {
+			p.documentDone = true
+		}
+	}
+
+	if piece != nil && p.maxPieces > 0 {
+		if p.pieces++; p.pieces > p.maxPieces {
+			err = &ParseError{Pos: p.start, Err: ErrTooManyPieces}
+			p.next, piece = errReader{err}, nil
+		}
+	}
+
+	if piece != nil && p.onNodeComplete != nil {
+		if err = p.completeNode(piece); err != nil {
+			p.next, piece = errReader{err}, nil
+		}
+	}
+
+	return piece, err
+}
+
+// SkipNode reads and discards pieces from r until the node most recently entered is left. It does nothing if no node
+// is open. The node is skipped in full, regardless of the parser's ReadBudget.
+func (p *Parser) SkipNode(r Reader) error {
+	depth := p.depth
+	for depth > 0 && p.depth >= depth {
+		if _, err := p.Read(r); err != nil && err != ErrWouldBlock {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPiece reads the next piece from r, before any preprocessing.
+func (p *Parser) readPiece(r Reader) (Piece, error) {
+	var piece Piece
+	var err error
+	if ahead := p.ahead; ahead != nil {
+		// A comment read ahead may begin the next merge.
+		p.ahead, p.start, p.end, p.commentInline = nil, ahead.start, ahead.end, ahead.inline
+		piece, err = ahead.piece, ahead.err
+	} else if p.merge != nil {
+		return p.mergeComment(r)
+	} else {
+		piece, err = p.step(r)
+	}
+	if p.mergeComments && err == nil {
+		if text, ok := p.lineComment(piece); ok {
+			p.merge = &merge{piece, text, p.start, p.end, p.start.Line}
+			return p.mergeComment(r)
+		}
+	}
+	return piece, err
+}
+
+// lookahead is a piece, or error, read ahead of the piece last returned by readPiece.
+type lookahead struct {
+	piece  Piece
+	err    error
+	start  Position
+	end    Position
+	inline bool
+}
+
+// merge is a comment on a line of its own, being merged by mergeComment.
+type merge struct {
+	piece Piece
+	text  string
+	start Position
+	end   Position
+	line  int // line of the last comment merged
+}
+
+// mergeComment returns the comment in p.merge with the text of the comments on the lines immediately following it
+// joined to it by newlines, as permitted by MergeComments. The piece read after the last comment merged is kept to be
+// returned by the next call to readPiece.
+func (p *Parser) mergeComment(r Reader) (Piece, error) {
+	m := p.merge
+	for {
+		next, err := p.step(r)
+		if err == ErrWouldBlock {
+			return nil, err
+		}
+		more, ok := p.lineComment(next)
+		if err != nil || !ok || p.start.Line != m.line+1 {
+			p.ahead = &lookahead{next, err, p.start, p.end, p.commentInline}
+			break
+		}
+		m.text += "\n" + more
+		m.line++
+		m.end = p.end
+		if c, ok := next.(DocComment); ok {
+			first, _ := m.piece.(DocComment)
+			first.End = c.End
+			m.piece = first
+		}
+	}
+
+	p.merge, p.start, p.end, p.commentInline = nil, m.start, m.end, false
+	if c, ok := m.piece.(DocComment); ok {
+		c.Text = m.text
+		return c, nil
+	}
+	return Comment(m.text), nil
+}
+
+// lineComment returns the text of piece if it is a comment that doesn't follow other content on its line.
+func (p *Parser) lineComment(piece Piece) (string, bool) {
+	switch c := piece.(type) {
+	case Comment:
+		return string(c), !p.commentInline
+	case DocComment:
+		return c.Text, !c.Inline
+	}
+	return "", false
+}
+
+// step reads the next piece from r by running the parser's states until a piece is read or an error occurs.
+func (p *Parser) step(r Reader) (piece Piece, err error) {
+	if p.next == nil && p.initialState != nil {
+		p.next = p.fromState(p.initialState)
+	} else if p.next == nil {
 		p.next = readFn(p.readKey)
 	}
 	for p.next != nil && piece == nil && err == nil {
 		p.next, piece, err = p.next.read(r)
 	}
+	if piece != nil {
+		p.end = p.lastContent
+		if p.termAhead {
+			p.end = p.prevContent
+		}
+	}
+	p.termAhead = false
+
+	if piece != nil && err != nil {
+		// A piece read up to an error is returned on its own and the error
+		// is returned by the next Read.
+		if err == io.EOF {
+			p.next = eofReader
+		} else {
+			p.next = errReader{err}
+		}
+		err = nil
+	}
 
 	return piece, err
 }
@@ -0,0 +1,1049 @@
+package sparse_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/nilium/sparse"
+	"github.com/nilium/sparse/sparsetest"
+)
+
+// parse parses src with the given configurations, failing t if an error occurs.
+func parse(t *testing.T, src string, configs ...sparse.Configuration) sparse.Document {
+	t.Helper()
+	doc, err := sparse.Parse(strings.NewReader(src), configs...)
+	if err != nil {
+		t.Fatalf("Parse(%q) = %v", src, err)
+	}
+	return doc
+}
+
+func TestTrimNodeNames(t *testing.T) {
+	cases := []struct {
+		src     string
+		configs []sparse.Configuration
+		want    sparse.NodeEnter
+	}{
+		{" name { \n}", nil, "name"},
+		{"name\t\t{}", nil, "name"},
+		{"name\\\n {}", []sparse.Configuration{sparse.CompressWhitespace(false)}, "name"},
+		{"name\\\t\\\n {}", []sparse.Configuration{sparse.CompressWhitespace(false)}, "name\t"}, // Escaped, so kept.
+		{`"quoted  " {}`, []sparse.Configuration{sparse.QuotedNames(true)}, "quoted  "},         // Quoted names are verbatim.
+	}
+	for _, c := range cases {
+		doc := parse(t, c.src, append(c.configs, sparse.TrimNodeNames(true))...)
+		sparsetest.AssertPieces(t, doc, c.want, sparse.NodeLeave(1))
+	}
+}
+
+func TestTrimNodeNamesDisabled(t *testing.T) {
+	doc := parse(t, "name\\\n {}", sparse.CompressWhitespace(false))
+	sparsetest.AssertPieces(t, doc, sparse.NodeEnter("name\n"), sparse.NodeLeave(1))
+}
+
+func TestCommentOrder(t *testing.T) {
+	src := "# first\n# second\na 1 # trailing\n\n# third\nb\n# last"
+	doc := parse(t, src, sparse.ReadComments(true))
+	sparsetest.AssertPieces(t, doc,
+		sparse.Comment(" first"),
+		sparse.Comment(" second"),
+		sparse.Field{Key: "a", Value: "1"},
+		sparse.Comment(" trailing"),
+		sparse.Comment(" third"),
+		sparse.Field{Key: "b"},
+		sparse.Comment(" last"),
+	)
+}
+
+func TestCommentAtEOF(t *testing.T) {
+	cases := []struct {
+		src  string
+		want []sparse.Piece
+	}{
+		{"a 1\n#", []sparse.Piece{sparse.Field{Key: "a", Value: "1"}, sparse.Comment("")}},
+		{"a 1 # end", []sparse.Piece{sparse.Field{Key: "a", Value: "1"}, sparse.Comment(" end")}},
+		{"a# end", []sparse.Piece{sparse.Field{Key: "a"}, sparse.Comment(" end")}},
+		{"a {\n}\n# end\n", []sparse.Piece{sparse.NodeEnter("a"), sparse.NodeLeave(1), sparse.Comment(" end")}},
+	}
+	for _, c := range cases {
+		sparsetest.AssertPieces(t, parse(t, c.src, sparse.ReadComments(true)), c.want...)
+
+		// Without ReadComments, only the comment is dropped.
+		var want []sparse.Piece
+		for _, piece := range c.want {
+			if piece.Kind() != sparse.KindComment {
+				want = append(want, piece)
+			}
+		}
+		sparsetest.AssertPieces(t, parse(t, c.src), want...)
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+	cases := []struct {
+		src      string
+		comments []sparse.Piece // read if ReadComments is set
+	}{
+		{"", nil},
+		{" \t\n\r\n\n  ", nil},
+		{"# only\n", []sparse.Piece{sparse.Comment(" only")}},
+		{"\n  # one\n\n#two", []sparse.Piece{sparse.Comment(" one"), sparse.Comment("two")}},
+		{"#\r\n#", []sparse.Piece{sparse.Comment(""), sparse.Comment("")}},
+	}
+	for _, c := range cases {
+		for _, readComments := range []bool{false, true} {
+			var want []sparse.Piece
+			if readComments {
+				want = c.comments
+			}
+			sparsetest.AssertPieces(t, parse(t, c.src, sparse.ReadComments(readComments)), want...)
+
+			p := sparse.NewParser(sparse.ReadComments(readComments))
+			r := strings.NewReader(c.src)
+			for range want {
+				if _, err := p.Read(r); err != nil {
+					t.Fatalf("Read(%q) = %v", c.src, err)
+				}
+			}
+			for i := 0; i < 2; i++ {
+				if piece, err := p.Read(r); err != io.EOF {
+					t.Errorf("Read(%q) = %#v, %v; want io.EOF", c.src, piece, err)
+				}
+			}
+		}
+	}
+}
+
+func TestContinuationJoin(t *testing.T) {
+	const grid = "grid\n\t1     1     1 \\\n\t1     1     1 \\\n\t1     1     1\n"
+	cases := []struct {
+		configs []sparse.Configuration
+		want    string
+	}{
+		{nil, "1 1 1\n1 1 1\n1 1 1"},
+		{[]sparse.Configuration{sparse.JoinNewline}, "1 1 1\n1 1 1\n1 1 1"},
+		{[]sparse.Configuration{sparse.JoinSpace}, "1 1 1 1 1 1 1 1 1"},
+		{[]sparse.Configuration{sparse.JoinNone}, "1 1 11 1 11 1 1"},
+	}
+	for _, c := range cases {
+		sparsetest.AssertPieces(t, parse(t, grid, c.configs...), sparse.Field{Key: "grid", Value: c.want})
+	}
+}
+
+func TestEscapesInKeysAndValues(t *testing.T) {
+	escapes := []string{
+		`\t`, `\n`, `\r`, `\b`, `\f`, `\0`, `\v`, `\\`, `\#`, `\;`, `\{`, `\}`, `\!`, `\ `, `\x`, `\=`, `\é`,
+	}
+	for _, esc := range escapes {
+		want := "a" + esc + "b"
+		doc := parse(t, want+" "+want, sparse.AssignmentOps{'='})
+		if len(doc) != 1 {
+			t.Errorf("escape %s: read %#v; want one field", esc, doc)
+			continue
+		}
+		f := doc[0].(sparse.Field)
+		if f.Key != f.Value {
+			t.Errorf("escape %s: key %q and value %q differ", esc, f.Key, f.Value)
+		}
+		if e, ok := sparse.Escapes()[[]rune(esc)[1]]; ok && f.Key != "a"+string(e)+"b" {
+			t.Errorf("escape %s: read %q; want %q", esc, f.Key, "a"+string(e)+"b")
+		}
+	}
+}
+
+func TestLeadingKeyEscapes(t *testing.T) {
+	defines := sparse.Defines{"x": false}
+	cases := []struct {
+		src     string
+		configs []sparse.Configuration
+		want    []sparse.Piece
+	}{
+		{`\!foo v`, nil, []sparse.Piece{sparse.Field{Key: "!foo", Value: "v"}}},
+		{"  \t\\!foo v", nil, []sparse.Piece{sparse.Field{Key: "!foo", Value: "v"}}},
+		{`\!foo!`, nil, []sparse.Piece{sparse.Field{Key: "!foo"}}},
+		{`\!foo v`, []sparse.Configuration{sparse.NegationPrefix(true)}, []sparse.Piece{
+			sparse.FieldEx{Field: sparse.Field{Key: "!foo", Value: "v"}},
+		}},
+		{`!\!foo v`, []sparse.Configuration{sparse.NegationPrefix(true)}, []sparse.Piece{
+			sparse.FieldEx{Field: sparse.Field{Key: "!foo", Value: "v"}, Negated: true},
+		}},
+		{`\#bar v`, nil, []sparse.Piece{sparse.Field{Key: "#bar", Value: "v"}}},
+		{`\#bar v`, []sparse.Configuration{sparse.ReadComments(true)}, []sparse.Piece{
+			sparse.Field{Key: "#bar", Value: "v"},
+		}},
+		{`\ baz v`, nil, []sparse.Piece{sparse.Field{Key: " baz", Value: "v"}}},
+		{"n {\n\t\\ baz v\n}", nil, []sparse.Piece{
+			sparse.NodeEnter("n"), sparse.Field{Key: " baz", Value: "v"}, sparse.NodeLeave(1),
+		}},
+
+		// An escaped '@' begins an ordinary key, even where a directive would be read.
+		{"\\@if x\na 1", []sparse.Configuration{defines}, []sparse.Piece{
+			sparse.Field{Key: "@if", Value: "x"}, sparse.Field{Key: "a", Value: "1"},
+		}},
+		{"@if x\na 1\n@endif\nb 2", []sparse.Configuration{defines}, []sparse.Piece{sparse.Field{Key: "b", Value: "2"}}},
+		{"@if x\n\\@endif y\n@endif\nb 2", []sparse.Configuration{defines}, []sparse.Piece{
+			sparse.Field{Key: "b", Value: "2"},
+		}},
+		{"\\@if x", []sparse.Configuration{defines, sparse.IndentStructure(true)}, []sparse.Piece{
+			sparse.Field{Key: "@if", Value: "x"},
+		}},
+		{"\\@foo bar", []sparse.Configuration{sparse.OnDirective(func(name, args string) error {
+			t.Errorf("OnDirective(%q, %q) called for an escaped directive", name, args)
+			return nil
+		})}, []sparse.Piece{sparse.Field{Key: "@foo", Value: "bar"}}},
+	}
+	for _, c := range cases {
+		sparsetest.AssertPieces(t, parse(t, c.src, c.configs...), c.want...)
+		sparsetest.AssertRoundTrip(t, c.src, c.configs...)
+	}
+
+	if got, want := encode(t, sparse.Field{Key: "@if", Value: "x"}), "\\@if x\n"; got != want {
+		t.Errorf("encoded %q; want %q", got, want)
+	}
+}
+
+func TestBraceAfterValue(t *testing.T) {
+	cases := []struct {
+		src  string
+		want []sparse.Piece
+	}{
+		{"key {\n}", []sparse.Piece{sparse.NodeEnter("key"), sparse.NodeLeave(1)}},
+		{"key\n{\n}", []sparse.Piece{sparse.NodeEnter("key"), sparse.NodeLeave(1)}},
+		{"key value{more}", []sparse.Piece{sparse.Field{Key: "key", Value: "value{more}"}}},
+		{"key value {", []sparse.Piece{sparse.Field{Key: "key", Value: "value {"}}},
+		{"key value {\n}", nil}, // The '}' leaves a node that was never entered.
+		{"n {\n\tkey value{more}\n}", []sparse.Piece{
+			sparse.NodeEnter("n"), sparse.Field{Key: "key", Value: "value{more}"}, sparse.NodeLeave(1),
+		}},
+		{"n {\n\tkey value}\n", []sparse.Piece{
+			sparse.NodeEnter("n"), sparse.Field{Key: "key", Value: "value"}, sparse.NodeLeave(1),
+		}},
+	}
+	for _, c := range cases {
+		doc, err := sparse.Parse(strings.NewReader(c.src))
+		if c.want == nil {
+			if !errors.Is(err, sparse.ErrUnexpectedNodeLeave) {
+				t.Errorf("Parse(%q) = %#v, %v; want %v", c.src, doc, err, sparse.ErrUnexpectedNodeLeave)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Parse(%q) = %v", c.src, err)
+		}
+		sparsetest.AssertPieces(t, doc, c.want...)
+		sparsetest.AssertRoundTrip(t, c.src)
+	}
+}
+
+func TestMaxKeyLen(t *testing.T) {
+	const limit = 1 << 10
+	key := strings.Repeat("k", 4<<20)
+	for _, src := range []string{key, key + " value", `"` + key + `"`} {
+		for _, r := range []sparse.Reader{
+			strings.NewReader(src), bufio.NewReader(strings.NewReader(src)), runeReader{strings.NewReader(src)},
+		} {
+			p := sparse.NewParser(sparse.MaxKeyLen(limit), sparse.QuotedNames(true))
+			piece, err := p.Read(r)
+			if !errors.Is(err, sparse.ErrKeyTooLong) {
+				t.Errorf("Read(%T) = %#v, %v; want %v", r, piece, err, sparse.ErrKeyTooLong)
+			}
+			// The buffer holds at most a little more than the limit, as read in bulk.
+			if n := sparse.BufCap(p); n > 16*limit {
+				t.Errorf("Read(%T) grew its buffer to %d bytes; want at most %d", r, n, 16*limit)
+			}
+		}
+	}
+
+	sparsetest.AssertPieces(t, parse(t, strings.Repeat("k", limit)+" v", sparse.MaxKeyLen(limit)),
+		sparse.Field{Key: strings.Repeat("k", limit), Value: "v"})
+}
+
+// errAfter returns a Reader that reads data and then fails with err.
+func errAfter(data string, err error) sparse.Reader {
+	return bufio.NewReader(io.MultiReader(strings.NewReader(data), iotest.ErrReader(err)))
+}
+
+func TestCommentReadError(t *testing.T) {
+	errRead := errors.New("read failed")
+	for _, src := range []string{"a 1 # cut", "a 1\n# cut"} {
+		for _, readComments := range []bool{false, true} {
+			want := []sparse.Piece{sparse.Field{Key: "a", Value: "1"}}
+			if readComments {
+				want = append(want, sparse.Comment(" cut"))
+			}
+
+			p := sparse.NewParser(sparse.ReadComments(readComments))
+			r := errAfter(src, errRead)
+			for i, w := range want {
+				piece, err := p.Read(r)
+				if err != nil {
+					t.Fatalf("%q, ReadComments(%t): Read %d = %v; want %#v", src, readComments, i, err, w)
+				}
+				sparsetest.AssertPieces(t, sparse.Document{piece}, w)
+			}
+			for i := 0; i < 2; i++ {
+				if piece, err := p.Read(r); err != errRead {
+					t.Errorf("%q, ReadComments(%t): Read = %#v, %v; want %v", src, readComments, piece, err, errRead)
+				}
+			}
+
+			doc, err := sparse.Parse(errAfter(src, errRead), sparse.ReadComments(readComments))
+			if err != errRead {
+				t.Errorf("%q, ReadComments(%t): Parse error = %v; want %v", src, readComments, err, errRead)
+			}
+			sparsetest.AssertPieces(t, doc, want...)
+		}
+	}
+}
+
+func TestInlineNode(t *testing.T) {
+	cases := []struct {
+		src  string
+		want []sparse.Piece
+	}{
+		{"k { x 1; y 2 }", []sparse.Piece{
+			sparse.NodeEnter("k"), sparse.Field{Key: "x", Value: "1"}, sparse.Field{Key: "y", Value: "2"},
+			sparse.NodeLeave(1),
+		}},
+		{"k {x 1;y 2}", []sparse.Piece{
+			sparse.NodeEnter("k"), sparse.Field{Key: "x", Value: "1"}, sparse.Field{Key: "y", Value: "2"},
+			sparse.NodeLeave(1),
+		}},
+		{"k { flag; x 1 }", []sparse.Piece{
+			sparse.NodeEnter("k"), sparse.Field{Key: "flag"}, sparse.Field{Key: "x", Value: "1"}, sparse.NodeLeave(1),
+		}},
+		{"a { b { c 1 } }", []sparse.Piece{
+			sparse.NodeEnter("a"), sparse.NodeEnter("b"), sparse.Field{Key: "c", Value: "1"}, sparse.NodeLeave(2),
+			sparse.NodeLeave(1),
+		}},
+	}
+	for _, c := range cases {
+		sparsetest.AssertPieces(t, parse(t, c.src), c.want...)
+	}
+}
+
+func TestSiblingNodes(t *testing.T) {
+	x, y := sparse.Field{Key: "x", Value: "1"}, sparse.Field{Key: "y", Value: "2"}
+	cases := []struct {
+		src  string
+		want []sparse.Piece
+	}{
+		{"a { x 1 } b { y 2 }", []sparse.Piece{
+			sparse.NodeEnter("a"), x, sparse.NodeLeave(1), sparse.NodeEnter("b"), y, sparse.NodeLeave(1),
+		}},
+		{"a {x 1}b {y 2}", []sparse.Piece{
+			sparse.NodeEnter("a"), x, sparse.NodeLeave(1), sparse.NodeEnter("b"), y, sparse.NodeLeave(1),
+		}},
+		{"a { x 1 } y 2", []sparse.Piece{sparse.NodeEnter("a"), x, sparse.NodeLeave(1), y}},
+		{"a { b { x 1 } c { y 2 } } flag!", []sparse.Piece{
+			sparse.NodeEnter("a"), sparse.NodeEnter("b"), x, sparse.NodeLeave(2), sparse.NodeEnter("c"), y,
+			sparse.NodeLeave(2), sparse.NodeLeave(1), sparse.Field{Key: "flag"},
+		}},
+	}
+	for _, c := range cases {
+		sparsetest.AssertPieces(t, parse(t, c.src), c.want...)
+		sparsetest.AssertRoundTrip(t, c.src)
+	}
+
+	sparsetest.AssertPieces(t, parse(t, "a { x 1 } b { y 2 } # c", sparse.ReadComments(true)),
+		sparse.NodeEnter("a"), x, sparse.NodeLeave(1), sparse.NodeEnter("b"), y, sparse.NodeLeave(1), sparse.Comment(" c"))
+}
+
+func TestLiteralHashKeys(t *testing.T) {
+	const src = "url http://host/path#frag\nother a#b\nurl #top # kept\nn { url /p#f }"
+	configs := []sparse.Configuration{sparse.ReadComments(true), sparse.LiteralHashKeys{"url"}}
+	sparsetest.AssertPieces(t, parse(t, src, configs...),
+		sparse.Field{Key: "url", Value: "http://host/path#frag"},
+		sparse.Field{Key: "other", Value: "a"},
+		sparse.Comment("b"),
+		sparse.Field{Key: "url", Value: "#top # kept"},
+		sparse.NodeEnter("n"),
+		sparse.Field{Key: "url", Value: "/p#f"},
+		sparse.NodeLeave(1),
+	)
+	sparsetest.AssertRoundTrip(t, src, configs...)
+
+	sparsetest.AssertPieces(t, parse(t, "url http://host/path#frag", sparse.ReadComments(true)),
+		sparse.Field{Key: "url", Value: "http://host/path"},
+		sparse.Comment("frag"),
+	)
+}
+
+func TestEscapedTrailingSpace(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`path\ `, "path "},
+		{"path\\  \t", "path "},
+		{"path\\\t \n", "path\t"},
+		{`a\ \ `, "a  "},
+		{"a \\  b  ", "a  b"},
+	}
+	for _, c := range cases {
+		src := "key " + c.src
+		sparsetest.AssertPieces(t, parse(t, src, sparse.TrimWhitespace(true)), sparse.Field{Key: "key", Value: c.want})
+		sparsetest.AssertRoundTrip(t, src, sparse.TrimWhitespace(true))
+	}
+}
+
+func TestIndentStructure(t *testing.T) {
+	a, b := sparse.Field{Key: "a", Value: "1"}, sparse.Field{Key: "b", Value: "2"}
+	cases := []struct {
+		src  string
+		want []sparse.Piece
+		err  error
+	}{
+		{"n\n\ta 1\n\tb 2\nc 3", []sparse.Piece{
+			sparse.NodeEnter("n"), a, b, sparse.NodeLeave(1), sparse.Field{Key: "c", Value: "3"},
+		}, nil},
+		{"n\n  a 1\n  b 2", []sparse.Piece{sparse.NodeEnter("n"), a, b, sparse.NodeLeave(1)}, nil},
+		{"n\n\tm\n\t\ta 1\n\tb 2", []sparse.Piece{
+			sparse.NodeEnter("n"), sparse.NodeEnter("m"), a, sparse.NodeLeave(2), b, sparse.NodeLeave(1),
+		}, nil},
+		// Every node still open is left at the end of input.
+		{"n\n\tm\n\t\ta 1", []sparse.Piece{
+			sparse.NodeEnter("n"), sparse.NodeEnter("m"), a, sparse.NodeLeave(2), sparse.NodeLeave(1),
+		}, nil},
+		// A field with no value is a flag unless the line after it is indented further.
+		{"flag\na 1", []sparse.Piece{sparse.Field{Key: "flag"}, a}, nil},
+		// Blank lines and comments don't end a node.
+		{"n\n\n\t# c\n\ta 1\n", []sparse.Piece{sparse.NodeEnter("n"), sparse.Comment(" c"), a, sparse.NodeLeave(1)}, nil},
+
+		{"n\n\ta 1\n  b 2", []sparse.Piece{sparse.NodeEnter("n"), a}, sparse.ErrMixedIndent},
+		{"a 1\n\tb 2", []sparse.Piece{a}, sparse.ErrUnexpectedIndent},
+		{"\ta 1", nil, sparse.ErrUnexpectedIndent},
+		{"n\n\t\ta 1\n\tb 2", []sparse.Piece{sparse.NodeEnter("n"), a, sparse.NodeLeave(1)}, sparse.ErrInconsistentIndent},
+		{"n {\n}", nil, sparse.ErrIndentBrace},
+	}
+	for _, c := range cases {
+		doc, err := sparse.Parse(strings.NewReader(c.src), sparse.IndentStructure(true), sparse.ReadComments(true))
+		if !errors.Is(err, c.err) || (err == nil) != (c.err == nil) {
+			t.Errorf("Parse(%q) = %v; want %v", c.src, err, c.err)
+		}
+		sparsetest.AssertPieces(t, doc, c.want...)
+	}
+}
+
+func TestDefines(t *testing.T) {
+	a, b, c := sparse.Field{Key: "a", Value: "1"}, sparse.Field{Key: "b", Value: "2"}, sparse.Field{Key: "c", Value: "3"}
+	defines := sparse.Defines{"yes": true, "no": false}
+	cases := []struct {
+		src  string
+		want []sparse.Piece
+		err  error
+		pos  sparse.Position // the position of err
+	}{
+		{"@if yes\na 1\n@endif\nb 2", []sparse.Piece{a, b}, nil, sparse.Position{}},
+		{"@if no\na 1\n@endif\nb 2", []sparse.Piece{b}, nil, sparse.Position{}},
+		{"@if unset\na 1\n@endif", nil, nil, sparse.Position{}},
+		{"@if yes\n@if no\na 1\n@endif\nb 2\n@endif\nc 3", []sparse.Piece{b, c}, nil, sparse.Position{}},
+		{"@if no\n@if yes\na 1\n@endif\nb 2\n@endif\nc 3", []sparse.Piece{c}, nil, sparse.Position{}},
+		{"n {\n\t@if no\n\ta 1\n\t@endif\n}", []sparse.Piece{sparse.NodeEnter("n"), sparse.NodeLeave(1)}, nil,
+			sparse.Position{}},
+		{"@if no\nn {\n\ta 1\n}\n@endif\nb 2", []sparse.Piece{b}, nil, sparse.Position{}},
+
+		{"a 1\n@if yes\nb 2", []sparse.Piece{a, b}, sparse.ErrMissingEndif, sparse.Position{Offset: 4, Line: 2, Column: 1}},
+		{"@if yes\n@if no\n@endif\n", nil, sparse.ErrMissingEndif, sparse.Position{Offset: 0, Line: 1, Column: 1}},
+		{"a 1\n@endif", []sparse.Piece{a}, sparse.ErrUnmatchedEndif, sparse.Position{Offset: 4, Line: 2, Column: 1}},
+		{"@if yes\nn {\n@endif\n}", []sparse.Piece{sparse.NodeEnter("n")}, sparse.ErrSectionDepth,
+			sparse.Position{Offset: 12, Line: 3, Column: 1}},
+	}
+	for _, c := range cases {
+		doc, err := sparse.Parse(strings.NewReader(c.src), defines)
+		sparsetest.AssertPieces(t, doc, c.want...)
+		if c.err == nil {
+			if err != nil {
+				t.Errorf("Parse(%q) = %v; want no error", c.src, err)
+			}
+			continue
+		}
+		var perr *sparse.ParseError
+		if !errors.As(err, &perr) || perr.Err != c.err {
+			t.Errorf("Parse(%q) = %v; want %v", c.src, err, c.err)
+		} else if perr.Pos != c.pos {
+			t.Errorf("Parse(%q) error at %#v; want %#v", c.src, perr.Pos, c.pos)
+		}
+	}
+
+	// Without Defines, directives are read as fields.
+	doc := parse(t, "@if no\na 1\n@endif x")
+	sparsetest.AssertPieces(t, doc, sparse.Field{Key: "@if", Value: "no"}, a, sparse.Field{Key: "@endif", Value: "x"})
+}
+
+func TestExtract(t *testing.T) {
+	const src = `a {
+	x 1
+	b {
+		x 2
+	}
+	c {
+		b { x 3 }
+		d { x 4 }
+	}
+}
+c {
+	b { x 5 }
+}
+d { x 6 }
+`
+	x := func(v string) sparse.Field { return sparse.Field{Key: "x", Value: v} }
+	// The pieces extracted are those read from src, so each NodeLeave keeps its depth in src.
+	cases := []struct {
+		path []string
+		want []sparse.Piece
+	}{
+		{[]string{"a", "b"}, []sparse.Piece{sparse.NodeEnter("b"), x("2"), sparse.NodeLeave(2)}},
+		{[]string{"a", "c", "d"}, []sparse.Piece{sparse.NodeEnter("d"), x("4"), sparse.NodeLeave(3)}},
+		// Names matched at the wrong depth are not along the path.
+		{[]string{"c", "b"}, []sparse.Piece{sparse.NodeEnter("b"), x("5"), sparse.NodeLeave(2)}},
+		{[]string{"b"}, nil},
+		{[]string{"d"}, []sparse.Piece{sparse.NodeEnter("d"), x("6"), sparse.NodeLeave(1)}},
+		{[]string{"a", "d"}, nil},
+		{[]string{"a", "c", "b", "x"}, nil},
+		{nil, nil},
+		{[]string{"a", "c"}, []sparse.Piece{
+			sparse.NodeEnter("c"),
+			sparse.NodeEnter("b"), x("3"), sparse.NodeLeave(3),
+			sparse.NodeEnter("d"), x("4"), sparse.NodeLeave(3),
+			sparse.NodeLeave(2),
+		}},
+	}
+	for _, c := range cases {
+		doc, err := sparse.Extract(strings.NewReader(src), c.path)
+		if err != nil {
+			t.Errorf("Extract(%q) = %v", c.path, err)
+		}
+		if c.want == nil && doc != nil {
+			t.Errorf("Extract(%q) = %#v; want nil", c.path, doc)
+		}
+		sparsetest.AssertPieces(t, doc, c.want...)
+	}
+
+	// Nothing is read past the node extracted.
+	errRead := errors.New("read past node")
+	doc, err := sparse.Extract(errAfter("a {\n\tx 1\n}\n", errRead), []string{"a"})
+	if err != nil {
+		t.Errorf("Extract = %v; want no error", err)
+	}
+	sparsetest.AssertPieces(t, doc, sparse.NodeEnter("a"), x("1"), sparse.NodeLeave(1))
+	if _, err := sparse.Extract(errAfter("a {\n\tx 1\n}\n", errRead), []string{"b"}); !errors.Is(err, errRead) {
+		t.Errorf("Extract = %v; want %v", err, errRead)
+	}
+}
+
+// countingReader counts the runes read from it through ReadRune.
+type countingReader struct {
+	runeReader
+	n int
+}
+
+func (r *countingReader) ReadRune() (rune, int, error) {
+	c, size, err := r.runeReader.ReadRune()
+	if err == nil {
+		r.n++
+	}
+	return c, size, err
+}
+
+func TestReadBudget(t *testing.T) {
+	inputs := []string{
+		"a 1\nb 2",
+		"key   a  b \\ c;d\tee!f # g\nh",
+		"n { m { a 1 } }\nflag!\nlong " + strings.Repeat("x", 100),
+		"é ü\n€ {\n}",
+		shader,
+	}
+	for _, src := range inputs {
+		want, err := sparse.Parse(strings.NewReader(src), sparse.ReadComments(true))
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", src, err)
+		}
+		for _, budget := range []int{1, 2, 3, 7, 64} {
+			p := sparse.NewParser(sparse.ReadBudget(budget), sparse.ReadComments(true))
+			r := &countingReader{runeReader: runeReader{strings.NewReader(src)}}
+			var doc sparse.Document
+			blocked := 0
+			for {
+				before := r.n
+				piece, err := p.Read(r)
+				if r.n-before > budget {
+					t.Errorf("Read(%q) with a budget of %d read %d runes", src, budget, r.n-before)
+				}
+				if err == io.EOF {
+					break
+				} else if err == sparse.ErrWouldBlock {
+					// The next call picks up where this one stopped.
+					blocked++
+					continue
+				} else if err != nil {
+					t.Fatalf("Read(%q) with a budget of %d = %v", src, budget, err)
+				}
+				doc = append(doc, piece)
+			}
+			sparsetest.AssertPieces(t, doc, want...)
+			if budget == 1 && blocked == 0 {
+				t.Errorf("Read(%q) with a budget of 1 never returned %v", src, sparse.ErrWouldBlock)
+			}
+		}
+	}
+}
+
+func TestRecoverTo(t *testing.T) {
+	f := func(k, v string) sparse.Field { return sparse.Field{Key: k, Value: v} }
+	const (
+		// An empty key in a node, followed by the rest of its paragraph and a nested node.
+		inNode = "n {\n\ta 1\n\t= x\n\tb 2\n\n\tc 3\n\tm { e 5 }\n}\nd 4"
+		// An empty key at the top level, followed by a node entered on a later line.
+		atTop = "= x\nb 2\nn { e 5\n}\nc 3\n\nd 4"
+		// A node name holding an escaped newline, rejecting the node.
+		rejected = "n {\n\tm\\\nx {\n\t\tb 2\n\t}\n\tc 3\n}\nd 4"
+	)
+	cases := []struct {
+		src  string
+		to   sparse.RecoverTo
+		want []sparse.Piece
+		errs int
+	}{
+		{inNode, sparse.RecoverToLine, []sparse.Piece{
+			sparse.NodeEnter("n"), f("a", "1"), f("b", "2"), f("c", "3"),
+			sparse.NodeEnter("m"), f("e", "5"), sparse.NodeLeave(2), sparse.NodeLeave(1), f("d", "4"),
+		}, 1},
+		{inNode, sparse.RecoverToBlankLine, []sparse.Piece{
+			sparse.NodeEnter("n"), f("a", "1"), f("c", "3"),
+			sparse.NodeEnter("m"), f("e", "5"), sparse.NodeLeave(2), sparse.NodeLeave(1), f("d", "4"),
+		}, 1},
+		{inNode, sparse.RecoverToNode, []sparse.Piece{
+			sparse.NodeEnter("n"), f("a", "1"), sparse.NodeLeave(1), f("d", "4"),
+		}, 1},
+
+		{atTop, sparse.RecoverToLine, []sparse.Piece{
+			f("b", "2"), sparse.NodeEnter("n"), f("e", "5"), sparse.NodeLeave(1), f("c", "3"), f("d", "4"),
+		}, 1},
+		{atTop, sparse.RecoverToBlankLine, []sparse.Piece{f("d", "4")}, 1},
+		// At the top level, RecoverToNode skips only the line of the error.
+		{atTop, sparse.RecoverToNode, []sparse.Piece{
+			f("b", "2"), sparse.NodeEnter("n"), f("e", "5"), sparse.NodeLeave(1), f("c", "3"), f("d", "4"),
+		}, 1},
+
+		// Only the rejected node is skipped, rather than the node holding it.
+		{rejected, sparse.RecoverToNode, []sparse.Piece{
+			sparse.NodeEnter("n"), f("c", "3"), sparse.NodeLeave(1), f("d", "4"),
+		}, 1},
+	}
+	for _, c := range cases {
+		doc, err := sparse.Parse(strings.NewReader(c.src),
+			sparse.Recover(true), c.to, sparse.RejectEmptyKeys(true), sparse.AssignmentOps{'='})
+		sparsetest.AssertPieces(t, doc, c.want...)
+		if me, ok := err.(sparse.MultiError); !ok || len(me) != c.errs {
+			t.Errorf("Parse(%q) with RecoverTo %d = %v; want %d errors", c.src, c.to, err, c.errs)
+		}
+	}
+}
+
+func TestNormalizingReader(t *testing.T) {
+	cases := []struct {
+		src     string
+		configs []sparse.Configuration
+		want    string
+	}{
+		{"", nil, ""},
+		{"a   1 ;b 2\nflag!", nil, "a 1\nb 2\nflag!\n"},
+		{"n {a 1\n m { }}", nil, "n {\n\ta 1\n\tm {\n\t}\n}\n"},
+		{"# c\na 1 # d", []sparse.Configuration{sparse.ReadComments(true)}, "# c\na 1\n# d\n"},
+		{"a 1\n# c", nil, "a 1\n"},
+		{shader, nil, ""},
+	}
+	for _, c := range cases {
+		want := c.want
+		if want == "" && c.src != "" {
+			var buf bytes.Buffer
+			if err := sparse.NewEncoder(&buf).Encode(parse(t, c.src, c.configs...)...); err != nil {
+				t.Fatal(err)
+			}
+			want = buf.String()
+		}
+		r := sparse.NewNormalizingReader(strings.NewReader(c.src), c.configs...)
+		if got, err := io.ReadAll(iotest.OneByteReader(r)); err != nil || string(got) != want {
+			t.Errorf("NewNormalizingReader(%q) read %q, %v; want %q", c.src, got, err, want)
+		}
+	}
+
+	// The pieces read before an error are returned ahead of it.
+	errRead := errors.New("read failed")
+	got, err := io.ReadAll(sparse.NewNormalizingReader(errAfter("a 1\nb 2\n", errRead)))
+	if want := "a 1\nb 2\n"; string(got) != want || !errors.Is(err, errRead) {
+		t.Errorf("NewNormalizingReader read %q, %v; want %q, %v", got, err, want, errRead)
+	}
+	got, err = io.ReadAll(sparse.NewNormalizingReader(strings.NewReader("a 1\n}\nb 2"), sparse.Recover(true)))
+	if want := "a 1\nb 2\n"; string(got) != want || !errors.Is(err, sparse.ErrUnexpectedNodeLeave) {
+		t.Errorf("NewNormalizingReader read %q, %v; want %q, %v", got, err, want, sparse.ErrUnexpectedNodeLeave)
+	}
+
+	// Each piece can be read as soon as it has been parsed, before the rest of the input is available.
+	pr, pw := io.Pipe()
+	go pw.Write([]byte("a 1\nb"))
+	r := sparse.NewNormalizingReader(bufio.NewReader(pr))
+	buf := make([]byte, 4)
+	if n, err := io.ReadFull(r, buf); err != nil || string(buf[:n]) != "a 1\n" {
+		t.Errorf("Read = %q, %v; want %q, nil", buf[:n], err, "a 1\n")
+	}
+	pw.Close()
+}
+
+func TestPieceAt(t *testing.T) {
+	const src = "a 1\nkey  value  \nn {\n\tb 2 # c\n}\nflag!"
+	doc, spans, err := sparse.ParseSpans(strings.NewReader(src), sparse.ReadComments(true))
+	if err != nil {
+		t.Fatalf("ParseSpans = %v", err)
+	} else if len(spans) != len(doc) {
+		t.Fatalf("ParseSpans returned %d spans for %d pieces", len(spans), len(doc))
+	}
+	wantText := []string{"a 1", "key  value", "n {", "b 2", "# c", "}", "flag!"}
+	for i, span := range spans {
+		if got := src[span.Start.Offset:span.End.Offset]; i >= len(wantText) || got != wantText[i] {
+			t.Errorf("span %d of %#v holds %q", i, doc[i], got)
+		}
+	}
+
+	cases := []struct {
+		offset int
+		want   sparse.Piece // nil if no piece is at offset
+	}{
+		{0, sparse.Field{Key: "a", Value: "1"}},
+		{2, sparse.Field{Key: "a", Value: "1"}},
+		{3, nil}, // The newline ending a line belongs to no piece.
+		{7, sparse.Field{Key: "key", Value: "value"}},
+		{13, sparse.Field{Key: "key", Value: "value"}},
+		{14, nil}, // Nor does the space trailing a value.
+		{16, nil},
+		{19, sparse.NodeEnter("n")},
+		{20, nil},
+		{21, nil},
+		{25, nil},
+		{26, sparse.Comment(" c")},
+		{28, sparse.Comment(" c")},
+		{29, nil},
+		{30, sparse.NodeLeave(1)},
+		{36, sparse.Field{Key: "flag"}},
+		{len(src), nil},
+		{-1, nil},
+	}
+	for _, c := range cases {
+		got, ok := doc.PieceAt(spans, c.offset)
+		if ok != (c.want != nil) || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("PieceAt(%d) = %#v, %t; want %#v", c.offset, got, ok, c.want)
+		}
+	}
+
+	// Spans beyond the end of the Document are ignored.
+	if got, ok := doc[:1].PieceAt(spans, 4); ok {
+		t.Errorf("PieceAt(4) = %#v, true on a truncated Document; want false", got)
+	}
+}
+
+func TestParseN(t *testing.T) {
+	const src = "a 1\nx { b 2 }\n# c\ny {\n\tz { }\n}\nd 4\nw { }\ne 5"
+	a, b, d, e := sparse.Field{Key: "a", Value: "1"}, sparse.Field{Key: "b", Value: "2"},
+		sparse.Field{Key: "d", Value: "4"}, sparse.Field{Key: "e", Value: "5"}
+	x := []sparse.Piece{a, sparse.NodeEnter("x"), b, sparse.NodeLeave(1)}
+	y := append(x[:len(x):len(x)], sparse.Comment(" c"), sparse.NodeEnter("y"), sparse.NodeEnter("z"),
+		sparse.NodeLeave(2), sparse.NodeLeave(1))
+	w := append(y[:len(y):len(y)], d, sparse.NodeEnter("w"), sparse.NodeLeave(1))
+	cases := []struct {
+		n    int
+		want []sparse.Piece
+	}{
+		{-1, nil},
+		{0, nil},
+		{1, x},
+		{2, y}, // Nodes within the first n aren't counted.
+		{3, w},
+		{4, append(w[:len(w):len(w)], e)},
+	}
+	for _, c := range cases {
+		doc, err := sparse.ParseN(strings.NewReader(src), c.n, sparse.ReadComments(true))
+		if err != nil {
+			t.Errorf("ParseN(%d) = %v", c.n, err)
+		}
+		sparsetest.AssertPieces(t, doc, c.want...)
+	}
+
+	// Nothing following the nth node is read.
+	errRead := errors.New("read past node")
+	doc, err := sparse.ParseN(errAfter("a 1\nx { b 2 }\n", errRead), 1)
+	if err != nil {
+		t.Errorf("ParseN = %v; want no error", err)
+	}
+	sparsetest.AssertPieces(t, doc, x...)
+	if _, err := sparse.ParseN(errAfter("a 1\nx { b 2 }\n", errRead), 2); !errors.Is(err, errRead) {
+		t.Errorf("ParseN = %v; want %v", err, errRead)
+	}
+}
+
+func TestOnNodeComplete(t *testing.T) {
+	type completed struct {
+		name     string
+		fields   []sparse.Field
+		children []string
+	}
+	errStop := errors.New("stop")
+	cases := []struct {
+		src  string
+		want []completed
+		err  error
+	}{
+		{"a 1\nn {\n\tb 2\n\tm { c 3 }\n\td 4\n}\ne 5", []completed{
+			{"m", []sparse.Field{{Key: "c", Value: "3"}}, nil},
+			{"n", []sparse.Field{{Key: "b", Value: "2"}, {Key: "d", Value: "4"}}, []string{"m"}},
+		}, nil},
+		{"x { }\ny { z { } }", []completed{{"x", nil, nil}, {"z", nil, nil}, {"y", nil, []string{"z"}}}, nil},
+		{"a 1\nb 2", nil, nil},
+		// Nodes left open at the end of input are never complete.
+		{"n { m { }", []completed{{"m", nil, nil}}, nil},
+		// An error returned by the callback ends the parse.
+		{"n { stop { } }\nm { }", []completed{{"stop", nil, nil}}, errStop},
+	}
+	for _, c := range cases {
+		var got []completed
+		fn := sparse.OnNodeComplete(func(node *sparse.Node) error {
+			var children []string
+			for _, child := range node.Children {
+				children = append(children, child.Name)
+			}
+			got = append(got, completed{node.Name, node.Fields, children})
+			if node.Name == "stop" {
+				return errStop
+			}
+			return nil
+		})
+		_, err := sparse.Parse(strings.NewReader(c.src), fn)
+		if err != c.err {
+			t.Errorf("Parse(%q) = %v; want %v", c.src, err, c.err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Parse(%q) completed %+v; want %+v", c.src, got, c.want)
+		}
+	}
+
+	// Once the callback has returned an error, Read keeps returning it.
+	p := sparse.NewParser(sparse.OnNodeComplete(func(*sparse.Node) error { return errStop }))
+	r := strings.NewReader("n { }\na 1")
+	if piece, err := p.Read(r); err != nil || piece != sparse.NodeEnter("n") {
+		t.Fatalf("Read = %#v, %v; want %#v", piece, err, sparse.NodeEnter("n"))
+	}
+	for i := 0; i < 2; i++ {
+		if piece, err := p.Read(r); piece != nil || err != errStop {
+			t.Errorf("Read = %#v, %v; want nil, %v", piece, err, errStop)
+		}
+	}
+}
+
+// shader is the example document from the package documentation.
+const shader = `textures/base/wall_arc_01 {
+	{ # unit
+		map textures/base/wall_arc_01.tga
+	}
+	{
+		map textures/base/wall_arc_01.glow.tga
+		blend add
+	}
+
+	next-line-brace
+	{
+	}
+
+	no-collision!
+	depth lte
+	alpha always
+	grid
+		1     1     1 \
+		1     1     1 \
+		1     1     1
+}
+`
+
+// fuzzConfigs are the configurations combined by FuzzParse, each given when its bit is set in the fuzzed flags.
+var fuzzConfigs = []sparse.Configuration{
+	sparse.ReadComments(true),
+	sparse.TrimWhitespace(false),
+	sparse.CompressWhitespace(false),
+	sparse.TrimNodeNames(true),
+	sparse.NegationPrefix(true),
+	sparse.NamedLeaves(true),
+	sparse.DocComments(true),
+	sparse.RichPieces(true),
+	sparse.KeepTerminators(true),
+	sparse.WrapRoot(true),
+	sparse.PositionalNodeValues(true),
+	sparse.IndentStructure(true),
+	sparse.Recover(true),
+	sparse.MergeComments(true),
+	sparse.RecoverErrors(true),
+	sparse.QuotedNames(true),
+	sparse.ParagraphValues(true),
+	sparse.VerbatimBlocks(true),
+	sparse.NormalizeLineEndings(true),
+	sparse.FieldDepth(true),
+	sparse.AssignmentOps{'=', ':'},
+	sparse.ValueTerminators{';', ','},
+	sparse.KeyWords(2),
+	sparse.Defines{"A": true},
+	sparse.Base64Blobs(true),
+	sparse.RecoverToNode,
+	sparse.ContinuationJoin(sparse.JoinSpace),
+	sparse.TabStop(4),
+	sparse.SpaceFunc(sparse.ASCIISpace),
+	sparse.LiteralHashKeys{"url"},
+}
+
+// FuzzParse checks that Parse neither panics nor hangs on any input, under combinations of configurations, and that it
+// never leaves a node it hasn't entered.
+func FuzzParse(f *testing.F) {
+	seeds := []string{
+		shader,
+		"",
+		"#",
+		"a 1\n#",
+		"a {",
+		"}",
+		"a { x 1; y 2 } b { y 2 }",
+		"key \\\n",
+		"\"quoted",
+		"@base64 k <<<\nAAAA",
+		"k {{ verbatim",
+		"#if A\na 1\n#endif\n",
+		"a\r\n\tb 1\r",
+		"url http://host/path#frag",
+	}
+	for i, seed := range seeds {
+		f.Add([]byte(seed), uint32(0))
+		f.Add([]byte(seed), uint32(1)<<uint(i%len(fuzzConfigs)))
+		f.Add([]byte(seed), ^uint32(0))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, flags uint32) {
+		var configs []sparse.Configuration
+		for i, cfg := range fuzzConfigs {
+			if flags&(1<<uint(i)) != 0 {
+				configs = append(configs, cfg)
+			}
+		}
+
+		type result struct {
+			doc sparse.Document
+			err error
+		}
+		done := make(chan result, 1)
+		go func() {
+			doc, err := sparse.Parse(strings.NewReader(string(data)), configs...)
+			done <- result{doc, err}
+		}()
+
+		select {
+		case res := <-done:
+			if !res.doc.AutoClose().Balanced() {
+				t.Errorf("Parse(%q) left a node it never entered: %#v", data, res.doc)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Parse(%q) did not return", data)
+		}
+	})
+}
+
+func TestCommentAtBufferBoundary(t *testing.T) {
+	// bufio.NewReaderSize never uses a buffer smaller than 16 bytes.
+	const size = 16
+	for pad := 0; pad <= size; pad++ {
+		for _, comment := range []string{"#", "#\n", "#\r\n", "# x\n#"} {
+			src := "a " + strings.Repeat("b", pad) + "\n" + comment
+			want := parse(t, src, sparse.ReadComments(true))
+			for _, r := range []sparse.Reader{
+				bufio.NewReaderSize(strings.NewReader(src), size),
+				bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(src)), size),
+			} {
+				doc, err := sparse.Parse(r, sparse.ReadComments(true))
+				if err != nil {
+					t.Errorf("Parse(%q) = %v", src, err)
+				}
+				sparsetest.AssertPieces(t, doc, want...)
+			}
+		}
+	}
+	sparsetest.AssertPieces(t, parse(t, "#", sparse.ReadComments(true)), sparse.Comment(""))
+	sparsetest.AssertPieces(t, parse(t, "#\n", sparse.ReadComments(true)), sparse.Comment(""))
+}
+
+// runeReader hides every method of a Reader but Read and ReadRune, so that nothing is read ahead of the parser.
+type runeReader struct{ r sparse.Reader }
+
+func (r runeReader) Read(b []byte) (int, error)   { return r.r.Read(b) }
+func (r runeReader) ReadRune() (rune, int, error) { return r.r.ReadRune() }
+
+func TestReaders(t *testing.T) {
+	inputs := []string{shader, "key   a  b \\ c;d\tee!f # g\n" + strings.Repeat("x", 1000) + " y\n", benchInput()[:4000]}
+	for _, input := range inputs {
+		for _, configs := range [][]sparse.Configuration{nil, {sparse.ReadBudget(7)}, {sparse.CompressWhitespace(false)}} {
+			want, wantSpans, err := sparse.ParseSpans(runeReader{strings.NewReader(input)}, configs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range []sparse.Reader{strings.NewReader(input), bufio.NewReaderSize(strings.NewReader(input), 16)} {
+				doc, spans, err := sparse.ParseSpans(r, configs...)
+				if err != nil {
+					t.Errorf("ParseSpans(%T) = %v", r, err)
+				}
+				sparsetest.AssertPieces(t, doc, want...)
+				if !reflect.DeepEqual(spans, wantSpans) {
+					t.Errorf("ParseSpans(%T) spans = %v; want %v", r, spans, wantSpans)
+				}
+			}
+		}
+	}
+}
+
+// benchInput returns an ASCII document of about 1MB, made of nodes holding fields with long values.
+func benchInput() string {
+	var b strings.Builder
+	for i := 0; b.Len() < 1<<20; i++ {
+		fmt.Fprintf(&b, "textures/base/wall_arc_%03d {\n", i)
+		fmt.Fprintf(&b, "\tmap textures/base/wall_arc_%03d.tga\n", i)
+		b.WriteString("\tdescription a plain value of several words, running on for most of a line of text\n")
+		b.WriteString("\tblend add; depth lte # an inline comment\n}\n")
+	}
+	return b.String()
+}
+
+// BenchmarkParse parses the same input through readers that take the fast path of reading runs of ASCII in bulk, under
+// "run", and through readers that are read a rune at a time, under "rune".
+func BenchmarkParse(b *testing.B) {
+	input := benchInput()
+	data := []byte(input)
+	readers := []struct {
+		name string
+		r    func() sparse.Reader
+	}{
+		{"run/bufio.Reader", func() sparse.Reader { return bufio.NewReader(strings.NewReader(input)) }},
+		{"run/strings.Reader", func() sparse.Reader { return strings.NewReader(input) }},
+		{"run/bytes.Reader", func() sparse.Reader { return bytes.NewReader(data) }},
+		{"rune/RuneReader", func() sparse.Reader { return runeReader{strings.NewReader(input)} }},
+		{"rune/ASCIIReader", func() sparse.Reader { return sparse.ASCIIReader{Reader: strings.NewReader(input)} }},
+	}
+	for _, r := range readers {
+		b.Run(r.name, func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i++ {
+				if _, err := sparse.Parse(r.r()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
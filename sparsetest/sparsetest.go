@@ -0,0 +1,61 @@
+// Package sparsetest provides helpers for testing code that uses package sparse. It is kept apart from package sparse
+// so that programs using sparse do not import package testing.
+package sparsetest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nilium/sparse"
+)
+
+// AssertPieces reports an error to t, listing each piece that differs by its GoString, unless got holds exactly the
+// pieces in want, in order.
+func AssertPieces(t testing.TB, got sparse.Document, want ...sparse.Piece) {
+	t.Helper()
+	if d := diff(got, want...); d != "" {
+		t.Errorf("pieces differ (-got +want):\n%s", d)
+	}
+}
+
+// AssertRoundTrip reports an error to t unless input, parsed with the given configurations, encoded by a
+// sparse.Encoder, and parsed again, is read as the same pieces both times.
+func AssertRoundTrip(t testing.TB, input string, configs ...sparse.Configuration) {
+	t.Helper()
+	doc, err := sparse.Parse(strings.NewReader(input), configs...)
+	if err != nil {
+		t.Errorf("parsing input: %v", err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := sparse.NewEncoder(&buf).Encode(doc...); err != nil {
+		t.Errorf("encoding input: %v", err)
+		return
+	}
+	got, err := sparse.Parse(bytes.NewReader(buf.Bytes()), configs...)
+	if err != nil {
+		t.Errorf("parsing encoded input %q: %v", buf.Bytes(), err)
+	} else if d := diff(got, doc...); d != "" {
+		t.Errorf("encoded input %q read differently (-got +want):\n%s", buf.Bytes(), d)
+	}
+}
+
+// diff returns a description of the differences between the pieces of got and want, one line per piece differing, or
+// the empty string if they hold the same pieces in the same order.
+func diff(got sparse.Document, want ...sparse.Piece) string {
+	var b strings.Builder
+	for i := 0; i < len(got) || i < len(want); i++ {
+		switch {
+		case i >= len(want):
+			fmt.Fprintf(&b, "%d: - %#v\n", i, got[i])
+		case i >= len(got):
+			fmt.Fprintf(&b, "%d: + %#v\n", i, want[i])
+		case !reflect.DeepEqual(got[i], want[i]):
+			fmt.Fprintf(&b, "%d: - %#v\n%d: + %#v\n", i, got[i], i, want[i])
+		}
+	}
+	return b.String()
+}
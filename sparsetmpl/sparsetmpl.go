@@ -0,0 +1,76 @@
+// Package sparsetmpl provides functions for rendering the nodes of documents parsed by package sparse with
+// text/template. It is kept apart from package sparse so that programs using sparse do not import text/template.
+package sparsetmpl
+
+import (
+	"text/template"
+
+	"github.com/nilium/sparse"
+)
+
+// FuncMap returns functions for use in a text/template that look up the fields and children of n, so that a parsed
+// document can be used as the data of a template. Each function looks in n by default, or in the node given as its
+// last argument, so that the nodes returned by child and children may be used as in
+//
+//	{{ range children "stage" }}{{ field "map" . }}{{ end }}
+//
+// or, piping a node to the function, {{ . | field "map" }}. The functions are:
+//
+//	field KEY     the value of the last field with the key, or the empty string if there is none
+//	fields KEY    the values of all fields with the key, in order
+//	flag KEY      whether a field with the key and no value occurs
+//	has KEY       whether a field with the key occurs
+//	child NAME    the last child node with the name, or nil if there is none
+//	children NAME the child nodes with the name, in order
+func FuncMap(n *sparse.Node) template.FuncMap {
+	node := func(nodes []*sparse.Node) *sparse.Node {
+		if len(nodes) > 0 && nodes[len(nodes)-1] != nil {
+			return nodes[len(nodes)-1]
+		}
+		return n
+	}
+
+	return template.FuncMap{
+		"field": func(key string, nodes ...*sparse.Node) string {
+			fields := node(nodes).FieldsByKey(key)
+			if len(fields) == 0 {
+				return ""
+			}
+			return fields[len(fields)-1].Value
+		},
+		"fields": func(key string, nodes ...*sparse.Node) []string {
+			var values []string
+			for _, f := range node(nodes).FieldsByKey(key) {
+				values = append(values, f.Value)
+			}
+			return values
+		},
+		"flag": func(key string, nodes ...*sparse.Node) bool {
+			return node(nodes).Flags()[key]
+		},
+		"has": func(key string, nodes ...*sparse.Node) bool {
+			return len(node(nodes).FieldsByKey(key)) > 0
+		},
+		"child": func(name string, nodes ...*sparse.Node) *sparse.Node {
+			children := childrenNamed(node(nodes), name)
+			if len(children) == 0 {
+				return nil
+			}
+			return children[len(children)-1]
+		},
+		"children": func(name string, nodes ...*sparse.Node) []*sparse.Node {
+			return childrenNamed(node(nodes), name)
+		},
+	}
+}
+
+// childrenNamed returns the children of n with the given name, in order.
+func childrenNamed(n *sparse.Node, name string) []*sparse.Node {
+	var children []*sparse.Node
+	for _, child := range n.Children {
+		if child.Name == name {
+			children = append(children, child)
+		}
+	}
+	return children
+}
@@ -0,0 +1,45 @@
+package sparsetmpl_test
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/nilium/sparse"
+	"github.com/nilium/sparse/sparsetmpl"
+)
+
+func TestFuncMap(t *testing.T) {
+	doc, err := sparse.Parse(strings.NewReader(`material {
+	stage { map a.tga; blend add }
+	stage { map b.tga; map c.tga; clamp! }
+	sort opaque
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := sparse.BuildTree(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	material := root.Children[0]
+
+	const text = `{{ field "sort" }} {{ has "missing" }}
+{{- range children "stage" }}
+{{ field "map" . }} {{ fields "map" . }} {{ flag "clamp" . }} {{ . | field "blend" }}
+{{- end }}
+{{ with child "stage" }}{{ field "map" . }}{{ end }} {{ child "missing" }}`
+	const want = `opaque false
+a.tga [a.tga] false add
+c.tga [b.tga c.tga] true 
+c.tga <nil>`
+
+	tmpl := template.Must(template.New("").Funcs(sparsetmpl.FuncMap(material)).Parse(text))
+	var b strings.Builder
+	if err := tmpl.Execute(&b, material); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("rendered:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package sparse
+
+// State is a state of a Parser, for dialects that need to read input the parser doesn't handle by itself, such as a
+// file that begins with a header. Read reads from r and returns the state that continues reading, along with the piece
+// read, if any. Returning the state given by Parser.KeyState continues reading as the parser does by default, and
+// returning a nil State ends the input as though io.EOF were read.
+//
+// A State should read runes through Parser.ReadRuneFrom, so that the parser's position and ReadBudget are kept, and
+// should return itself, or a state that resumes where it stopped, along with ErrWouldBlock if ReadRuneFrom returns it.
+// The Pos of a piece read by a State is the position at which the State began reading.
+type State interface {
+	Read(p *Parser, r Reader) (State, Piece, error)
+}
+
+// StateFunc is a State implemented by a function.
+type StateFunc func(p *Parser, r Reader) (State, Piece, error)
+
+func (fn StateFunc) Read(p *Parser, r Reader) (State, Piece, error) { return fn(p, r) }
+
+// InitialState sets the State in which the parser begins reading its input, in place of the state returned by
+// Parser.KeyState.
+type InitialState struct {
+	State State
+}
+
+func (s InitialState) apply(p *Parser) { p.initialState = s.State }
+
+// KeyState returns the state in which the parser reads keys, as it does at the start of its input by default.
+func (p *Parser) KeyState() State { return parserState{readFn(p.readKey)} }
+
+// ReadRuneFrom reads a rune from r for a State, as the parser reads its own input.
+func (p *Parser) ReadRuneFrom(r Reader) (rune, int, error) { return p.readRune(r) }
+
+// Unread returns c, the rune of size bytes last read by ReadRuneFrom, to the parser to be read again.
+func (p *Parser) Unread(c rune, size int) { p.unreadRune(c, size) }
+
+// parserState is a State running one of the parser's own states.
+type parserState struct {
+	next parser
+}
+
+func (s parserState) Read(p *Parser, r Reader) (State, Piece, error) {
+	next, piece, err := s.next.read(r)
+	if next == nil {
+		return nil, piece, err
+	}
+	return parserState{next}, piece, err
+}
+
+// stateParser is a parser running a State given to the parser.
+type stateParser struct {
+	p     *Parser
+	state State
+	start Position // the position at which the state began reading
+}
+
+// fromState returns the parser running s.
+func (p *Parser) fromState(s State) parser {
+	switch s := s.(type) {
+	case nil:
+		return eofReader
+	case parserState:
+		return s.next
+	}
+	return &stateParser{p: p, state: s, start: p.pos}
+}
+
+func (s *stateParser) read(r Reader) (parser, Piece, error) {
+	next, piece, err := s.state.Read(s.p, r)
+	if err == ErrWouldBlock && piece == nil {
+		s.state = next
+		return s, nil, err
+	}
+	if piece != nil {
+		s.p.start = s.start
+	}
+	return s.p.fromState(next), piece, err
+}
@@ -0,0 +1,45 @@
+package sparse
+
+// DocStats describes the size and shape of a document, as computed by Stats.
+type DocStats struct {
+	Nodes        int // nodes entered
+	MaxDepth     int // depth of the most deeply nested node, or zero if there are no nodes
+	Fields       int
+	Comments     int
+	Bytes        int // bytes of input read
+	LongestValue int // length, in bytes, of the longest field value
+}
+
+// Stats reads all pieces from r, as Parse does, and returns statistics describing them. Pieces are counted as they are
+// read, so the document is never held in full. Comments are always read, so that they can be counted. If an error
+// occurs, the statistics of the input read up to it are returned along with it.
+func Stats(r Reader, configs ...Configuration) (DocStats, error) {
+	var p Parser
+	p.Reset(append(configs[:len(configs):len(configs)], ReadComments(true))...)
+	var stats DocStats
+	for {
+		piece, err := p.Read(r)
+		if err == ErrWouldBlock {
+			continue
+		} else if err != nil {
+			stats.Bytes = p.pos.Offset
+			return stats, p.parseErr(err)
+		}
+
+		switch piece.Kind() {
+		case KindNodeEnter:
+			stats.Nodes++
+			if p.depth > stats.MaxDepth {
+				stats.MaxDepth = p.depth
+			}
+		case KindField:
+			f, _ := fieldOf(piece)
+			stats.Fields++
+			if len(f.Value) > stats.LongestValue {
+				stats.LongestValue = len(f.Value)
+			}
+		case KindComment:
+			stats.Comments++
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package sparse
+
+import "errors"
+
+// ErrUnclosedNode is returned by BuildTree when the pieces it was given end before all nodes have been left.
+var ErrUnclosedNode = errors.New("sparse: unclosed node")
+
+// Node is a node in a tree built from a sequence of Pieces. The root of a tree is given the empty name and holds all
+// top-level fields and nodes. Comments are not retained in the tree.
+type Node struct {
+	Name     string
+	Fields   []Field
+	Children []*Node
+
+	multi map[string][]string // values of each key, if the node's repeated keys are folded
+}
+
+// TreeOption configures how BuildTree assembles a tree.
+type TreeOption interface {
+	applyTree(*treeBuilder)
+}
+
+// FoldRepeatedKeys causes BuildTree to fold the fields of each node that share a key into a single entry, so that a
+// key repeated to give a list of values occurs once in the node's Fields, as the first field with that key, and its
+// values are all returned, in order, by Multi. Fields added by AddField to a node built this way are folded as well.
+// EachField, Collect, FieldsByKey, Flags, and FlagList read each of a folded key's values as a field of its own, in
+// place of the key's entry in Fields, as do Encoders. Lint's DuplicateKeys rule reads pieces rather than trees, and so
+// still reports repeated keys regardless of folding.
+type FoldRepeatedKeys bool
+
+func (b FoldRepeatedKeys) applyTree(t *treeBuilder) { t.fold = bool(b) }
+
+// NewNode returns a new, empty node with the given name.
+func NewNode(name string) *Node {
+	return &Node{Name: name}
+}
+
+// AddField appends a field to n and returns n.
+func (n *Node) AddField(key, value string) *Node {
+	n.addField(Field{key, value})
+	return n
+}
+
+func (n *Node) addField(f Field) {
+	if n.multi == nil {
+		n.Fields = append(n.Fields, f)
+		return
+	}
+	if values, ok := n.multi[f.Key]; ok {
+		n.multi[f.Key] = append(values, f.Value)
+		return
+	}
+	n.multi[f.Key] = []string{f.Value}
+	n.Fields = append(n.Fields, f)
+}
+
+// Multi returns the values of the fields of n, not including those of its children, with the given key, in order,
+// whether or not its repeated keys were folded by FoldRepeatedKeys.
+func (n *Node) Multi(key string) []string {
+	var values []string
+	for _, f := range n.FieldsByKey(key) {
+		values = append(values, f.Value)
+	}
+	return values
+}
+
+// unfold returns fields, which are fields of n, with the entry of each key folded by FoldRepeatedKeys replaced by a
+// field for each of the key's values.
+func (n *Node) unfold(fields []Field) []Field {
+	if n.multi == nil {
+		return fields
+	}
+	unfolded := make([]Field, 0, len(fields))
+	for _, f := range fields {
+		values, ok := n.multi[f.Key]
+		if !ok {
+			unfolded = append(unfolded, f)
+		}
+		for _, value := range values {
+			unfolded = append(unfolded, f.WithValue(value))
+		}
+	}
+	return unfolded
+}
+
+// AddFlag appends a field with no value to n and returns n.
+func (n *Node) AddFlag(key string) *Node {
+	return n.AddField(key, "")
+}
+
+// AddChild appends child to the children of n and returns n.
+func (n *Node) AddChild(child *Node) *Node {
+	n.Children = append(n.Children, child)
+	return n
+}
+
+// Walk calls fn for n and each node beneath it, depth-first, along with the path of node names leading from n to the
+// node. The path does not include the name of n and must not be retained by fn. If fn returns false, the nodes beneath
+// that node are not visited.
+func (n *Node) Walk(fn func(path []string, node *Node) bool) {
+	n.walk(nil, fn)
+}
+
+func (n *Node) walk(path []string, fn func([]string, *Node) bool) {
+	if !fn(path, n) {
+		return
+	}
+	for _, child := range n.Children {
+		child.walk(append(path, child.Name), fn)
+	}
+}
+
+// Each calls fn for each child of n, in order, without descending into the children's own children. Use Walk to visit
+// every node beneath n.
+func (n *Node) Each(fn func(*Node)) {
+	for _, child := range n.Children {
+		fn(child)
+	}
+}
+
+// EachField calls fn for each field of n, in order, not including the fields of its children.
+func (n *Node) EachField(fn func(Field)) {
+	for _, f := range n.unfold(n.Fields) {
+		fn(f)
+	}
+}
+
+// Collect returns the fields of n and all nodes beneath it for which pred returns true, in depth-first order. Use Walk
+// to also find the paths of the nodes holding matching fields.
+func (n *Node) Collect(pred func(Field) bool) []Field {
+	var fields []Field
+	n.Walk(func(_ []string, node *Node) bool {
+		for _, f := range node.unfold(node.Fields) {
+			if pred(f) {
+				fields = append(fields, f)
+			}
+		}
+		return true
+	})
+	return fields
+}
+
+// FieldsByKey returns the fields of n, not including those of its children, with the given key.
+func (n *Node) FieldsByKey(key string) []Field {
+	var fields []Field
+	for _, f := range n.unfold(n.Fields) {
+		if f.Key == key {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// childrenNamed returns the children of n with the given name, in order.
+func (n *Node) childrenNamed(name string) []*Node {
+	var children []*Node
+	for _, child := range n.Children {
+		if child.Name == name {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// Flags returns the set of keys of the fields of n, not including those of its children, that have no value.
+func (n *Node) Flags() map[string]bool {
+	flags := make(map[string]bool)
+	for _, f := range n.unfold(n.Fields) {
+		if f.Value == "" {
+			flags[f.Key] = true
+		}
+	}
+	return flags
+}
+
+// FlagList returns the keys of the fields of n, not including those of its children, that have no value. Keys are
+// returned in the order they first occur in n, and only once each.
+func (n *Node) FlagList() []string {
+	var flags []string
+	seen := make(map[string]bool)
+	for _, f := range n.unfold(n.Fields) {
+		if f.Value == "" && !seen[f.Key] {
+			seen[f.Key] = true
+			flags = append(flags, f.Key)
+		}
+	}
+	return flags
+}
+
+// BuildTree assembles the given pieces into a tree and returns its root. It returns ErrUnexpectedNodeLeave if a node is
+// left more times than it is entered and ErrUnclosedNode if the pieces do not leave every node they enter.
+func BuildTree(pieces []Piece, opts ...TreeOption) (*Node, error) {
+	var b treeBuilder
+	for _, opt := range opts {
+		opt.applyTree(&b)
+	}
+	b.reset()
+	for _, piece := range pieces {
+		if _, err := b.add(piece); err != nil {
+			return nil, err
+		}
+	}
+	if len(b.stack) > 1 {
+		return nil, ErrUnclosedNode
+	}
+	return b.root(), nil
+}
+
+// treeBuilder accumulates pieces into a tree of Nodes.
+type treeBuilder struct {
+	stack []*Node
+	fold  bool // whether repeated keys are folded, if FoldRepeatedKeys is set
+}
+
+func (b *treeBuilder) reset() {
+	b.stack = append(b.stack[:0], b.newNode(""))
+}
+
+// newNode returns a new node with the given name, folding its repeated keys if FoldRepeatedKeys is set.
+func (b *treeBuilder) newNode(name string) *Node {
+	n := &Node{Name: name}
+	if b.fold {
+		n.multi = make(map[string][]string)
+	}
+	return n
+}
+
+func (b *treeBuilder) root() *Node {
+	return b.stack[0]
+}
+
+func (b *treeBuilder) top() *Node {
+	return b.stack[len(b.stack)-1]
+}
+
+// add adds the piece to the tree. If the piece leaves a node, that node is returned.
+func (b *treeBuilder) add(piece Piece) (*Node, error) {
+	switch piece := piece.(type) {
+	case Field, FieldEx, BlobField:
+		f, _ := fieldOf(piece)
+		b.top().addField(f)
+	case NodeEnter, NodeEnterEx:
+		name, _ := enterName(piece)
+		node := b.newNode(name)
+		top := b.top()
+		top.Children = append(top.Children, node)
+		b.stack = append(b.stack, node)
+	case NodeLeave, NamedNodeLeave:
+		if len(b.stack) == 1 {
+			return nil, ErrUnexpectedNodeLeave
+		}
+		node := b.top()
+		b.stack = b.stack[:len(b.stack)-1]
+		return node, nil
+	}
+	return nil, nil
+}
+
+// completeNode adds piece to the parser's tree and passes any node it completes to the parser's OnNodeComplete
+// callback. Top-level nodes and fields are released once added, so only the nodes currently open are retained.
+func (p *Parser) completeNode(piece Piece) error {
+	b := &p.tree
+	if len(b.stack) == 0 {
+		b.reset()
+	}
+
+	node, err := b.add(piece)
+	if len(b.stack) == 1 {
+		root := b.root()
+		root.Fields, root.Children = nil, nil
+	}
+	if node == nil || err != nil {
+		return err
+	}
+	return p.onNodeComplete(node)
+}
@@ -0,0 +1,82 @@
+package sparse_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/nilium/sparse"
+	"github.com/nilium/sparse/sparsetmpl"
+)
+
+func TestFoldRepeatedKeys(t *testing.T) {
+	doc := parse(t, "list a; other x; list b; flag; list; node { list c }")
+	folded, err := sparse.BuildTree(doc, sparse.FoldRepeatedKeys(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := sparse.BuildTree(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []sparse.Field{{Key: "list", Value: "a"}, {Key: "other", Value: "x"}, {Key: "flag"}}
+	if !reflect.DeepEqual(folded.Fields, want) {
+		t.Errorf("Fields = %v; want %v", folded.Fields, want)
+	}
+	if got, want := folded.Multi("list"), []string{"a", "b", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Multi = %q; want %q", got, want)
+	}
+
+	// Folding changes only how Fields holds repeated keys, so each accessor reads the same values as without it, all
+	// those of a folded key being read in place of its first field.
+	cases := []struct {
+		node  *sparse.Node
+		each  []sparse.Field
+		flags []string
+	}{
+		{folded, []sparse.Field{{Key: "list", Value: "a"}, {Key: "list", Value: "b"}, {Key: "list"},
+			{Key: "other", Value: "x"}, {Key: "flag"}}, []string{"list", "flag"}},
+		{plain, []sparse.Field{{Key: "list", Value: "a"}, {Key: "other", Value: "x"}, {Key: "list", Value: "b"},
+			{Key: "flag"}, {Key: "list"}}, []string{"flag", "list"}},
+	}
+	for _, c := range cases {
+		n := c.node
+		want := []sparse.Field{{Key: "list", Value: "a"}, {Key: "list", Value: "b"}, {Key: "list"}}
+		if got := n.FieldsByKey("list"); !reflect.DeepEqual(got, want) {
+			t.Errorf("FieldsByKey = %v; want %v", got, want)
+		}
+		want = append(want, sparse.Field{Key: "list", Value: "c"})
+		if got := n.Collect(func(f sparse.Field) bool { return f.Key == "list" }); !reflect.DeepEqual(got, want) {
+			t.Errorf("Collect = %v; want %v", got, want)
+		}
+		if got, want := n.Flags(), map[string]bool{"list": true, "flag": true}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Flags = %v; want %v", got, want)
+		}
+		if got := n.FlagList(); !reflect.DeepEqual(got, c.flags) {
+			t.Errorf("FlagList = %v; want %v", got, c.flags)
+		}
+		var each []sparse.Field
+		n.EachField(func(f sparse.Field) { each = append(each, f) })
+		if !reflect.DeepEqual(each, c.each) {
+			t.Errorf("EachField = %v; want %v", each, c.each)
+		}
+
+		tmpl := template.Must(template.New("").Funcs(sparsetmpl.FuncMap(n)).Parse(`{{ fields "list" }} {{ field "list" }}`))
+		var b strings.Builder
+		if err := tmpl.Execute(&b, nil); err != nil {
+			t.Fatal(err)
+		} else if got, want := b.String(), "[a b ] "; got != want {
+			t.Errorf("template = %q; want %q", got, want)
+		}
+	}
+
+	var b strings.Builder
+	if err := sparse.NewEncoder(&b).EncodeTree(folded); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "list a\nlist b\nlist!\nother x\nflag!\nnode {\n\tlist c\n}\n"; got != want {
+		t.Errorf("EncodeTree = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,317 @@
+package sparse
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// UnmarshalMap parses data and returns its top-level fields and nodes as a map from keys and node names to values.
+//
+// A field's value is held as a string, with fields that have no value, such as flags, held as the empty string. A
+// node's contents are held as a nested map of the same form. A key used by more than one field is held as a []string
+// and a name used by more than one node as a []map[string]interface{}, both in the order they occur in data. A name
+// used by both fields and nodes is held as a []interface{} of the fields' values followed by the nodes' maps. Comments
+// are not retained.
+func UnmarshalMap(data []byte, configs ...Configuration) (map[string]interface{}, error) {
+	doc, err := Parse(bytes.NewReader(data), configs...)
+	if err != nil {
+		return nil, err
+	}
+	root, err := BuildTree(doc)
+	if err != nil {
+		return nil, err
+	}
+	return nodeMap(root), nil
+}
+
+// nodeMap returns the fields and children of n as a map, as described by UnmarshalMap.
+func nodeMap(n *Node) map[string]interface{} {
+	values := make(map[string][]interface{}, len(n.Fields)+len(n.Children))
+	for _, f := range n.Fields {
+		values[f.Key] = append(values[f.Key], f.Value)
+	}
+	for _, child := range n.Children {
+		values[child.Name] = append(values[child.Name], nodeMap(child))
+	}
+
+	m := make(map[string]interface{}, len(values))
+	for name, v := range values {
+		m[name] = mapValue(v)
+	}
+	return m
+}
+
+// mapValue returns the value held by UnmarshalMap for a name with the given values.
+func mapValue(values []interface{}) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+
+	strs := make([]string, 0, len(values))
+	maps := make([]map[string]interface{}, 0, len(values))
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			strs = append(strs, v)
+		case map[string]interface{}:
+			maps = append(maps, v)
+		}
+	}
+	switch len(values) {
+	case len(strs):
+		return strs
+	case len(maps):
+		return maps
+	}
+	return values
+}
+
+// ErrInvalidUnmarshal is returned by Unmarshal when it is not given a non-nil pointer to a struct.
+var ErrInvalidUnmarshal = errors.New("sparse: Unmarshal requires a non-nil pointer to a struct")
+
+// UnmarshalError is an error decoding a field or node into a struct. Path holds the names of the nodes, from the root,
+// leading to the node holding the field or node named by Key.
+type UnmarshalError struct {
+	Path []string
+	Key  string
+	Err  error
+}
+
+func (e *UnmarshalError) Error() string {
+	return fmt.Sprintf("sparse: cannot unmarshal %q (node %q): %v", e.Key, e.Path, e.Err)
+}
+
+func (e *UnmarshalError) Unwrap() error { return e.Err }
+
+// Unmarshal parses data and stores its top-level fields and nodes in the struct pointed to by v.
+//
+// Each exported struct field is matched to the fields and child nodes whose key or name is given by its `sparse` tag,
+// or by the struct field's name if it has no tag. Struct fields tagged "-" are ignored, as are fields and nodes that
+// match no struct field. Matching is case-sensitive.
+//
+// A struct field of string, bool, integer, or floating-point type, or whose address implements
+// encoding.TextUnmarshaler, is set from the value of the last field with its key. A bool is also set to true by a
+// field with no value, such as a flag. A struct or pointer to struct is decoded from the contents of the last child
+// node with its name. A slice collects every matching field or child node, in order, decoding each into an element of
+// the slice, so that a struct field of type []Unit tagged `sparse:"unit"` holds one Unit for each node named unit.
+//
+// Nodes with an empty name are matched by struct fields tagged with the "anon" option, as in `sparse:",anon"`. A
+// slice so tagged collects every anonymous child node, while other struct fields so tagged are each decoded from the
+// next anonymous child node by position. If a key is also given, as in `sparse:"stage,anon"`, nodes with that name
+// are matched as well.
+func Unmarshal(data []byte, v interface{}, configs ...Configuration) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrInvalidUnmarshal
+	}
+
+	doc, err := Parse(bytes.NewReader(data), configs...)
+	if err != nil {
+		return err
+	}
+	root, err := BuildTree(doc)
+	if err != nil {
+		return err
+	}
+	return unmarshalNode(nil, root, rv.Elem())
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// structField is an exported struct field matched by Unmarshal.
+type structField struct {
+	index int
+	key   string
+	anon  bool
+}
+
+// structFields returns the struct fields of t that Unmarshal may set.
+func structFields(t reflect.Type) []structField {
+	fields := make([]structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag, ok := sf.Tag.Lookup("sparse")
+		if tag == "-" {
+			continue
+		}
+		key, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i != -1 {
+			key, opts = tag[:i], tag[i+1:]
+		}
+		f := structField{index: i, key: key}
+		for _, opt := range strings.Split(opts, ",") {
+			f.anon = f.anon || opt == "anon"
+		}
+		if !ok || (key == "" && !f.anon) {
+			f.key = sf.Name
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// unmarshalNode stores the fields and children of node in the struct dst.
+func unmarshalNode(path []string, node *Node, dst reflect.Value) error {
+	var anon []*Node
+	for _, child := range node.Children {
+		if child.Name == "" {
+			anon = append(anon, child)
+		}
+	}
+
+	for _, f := range structFields(dst.Type()) {
+		v := dst.Field(f.index)
+		var children []*Node
+		if f.key != "" {
+			children = node.childrenNamed(f.key)
+		}
+		if f.anon && v.Kind() != reflect.Slice && isNodeType(v.Type()) {
+			// Anonymous nodes are given, by position, to the struct fields that take one node each.
+			if len(anon) > 0 {
+				children = append(children, anon[0])
+				anon = anon[1:]
+			}
+		} else if f.anon {
+			children = append(children, anon...)
+		}
+
+		key := f.key
+		var err error
+		switch {
+		case isNodeType(v.Type()):
+			if len(children) > 0 {
+				child := children[len(children)-1]
+				key = child.Name
+				err = unmarshalChild(path, child, v)
+			}
+		case v.Kind() == reflect.Slice && isNodeType(v.Type().Elem()):
+			if len(children) > 0 {
+				err = unmarshalChildren(path, children, v)
+			}
+		default:
+			err = unmarshalFields(node.FieldsByKey(f.key), v)
+		}
+		if err != nil {
+			if _, ok := err.(*UnmarshalError); !ok {
+				err = &UnmarshalError{Path: path, Key: key, Err: err}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// isNodeType returns whether Unmarshal decodes a value of type t from a node rather than a field.
+func isNodeType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// unmarshalChild decodes child into v, which is a struct or pointer to struct.
+func unmarshalChild(path []string, child *Node, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return unmarshalNode(append(path[:len(path):len(path)], child.Name), child, v)
+}
+
+// unmarshalChildren decodes each of children into a new element appended to the slice v.
+func unmarshalChildren(path []string, children []*Node, v reflect.Value) error {
+	s := reflect.MakeSlice(v.Type(), len(children), len(children))
+	for i, child := range children {
+		if err := unmarshalChild(path, child, s.Index(i)); err != nil {
+			return err
+		}
+	}
+	v.Set(reflect.AppendSlice(v, s))
+	return nil
+}
+
+// unmarshalFields stores the values of fields in v. If v is a slice, each value is appended to it; otherwise, v is set
+// from the last field, if any.
+func unmarshalFields(fields []Field, v reflect.Value) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 &&
+		!v.Addr().Type().Implements(textUnmarshalerType) {
+		s := reflect.MakeSlice(v.Type(), len(fields), len(fields))
+		for i, f := range fields {
+			if err := unmarshalValue(f.Value, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		if len(fields) > 0 {
+			v.Set(reflect.AppendSlice(v, s))
+		}
+		return nil
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return unmarshalValue(fields[len(fields)-1].Value, v)
+}
+
+// unmarshalValue sets v from a field's value.
+func unmarshalValue(value string, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported type %v", v.Type())
+		}
+		v.SetBytes([]byte(value))
+	case reflect.Bool:
+		if value == "" {
+			v.SetBool(true)
+			break
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package sparse_test
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nilium/sparse"
+)
+
+// upper is a TextUnmarshaler holding text in upper case.
+type upper string
+
+func (u *upper) UnmarshalText(text []byte) error {
+	*u = upper(strings.ToUpper(string(text)))
+	return nil
+}
+
+type stage struct {
+	Map   string `sparse:"map"`
+	Blend string `sparse:"blend"`
+}
+
+type shaderDef struct {
+	Depth       string `sparse:"depth"`
+	NoCollision bool   `sparse:"no-collision"`
+	Alpha       bool   `sparse:"alpha"`
+	Skip        string `sparse:"-"`
+	Name        upper  `sparse:"name"`
+	Data        []byte `sparse:"data"`
+	Size        int    `sparse:"size"`
+	Scale       float64
+	Tags        []string `sparse:"tag"`
+	First       stage    `sparse:",anon"`
+	Second      *stage   `sparse:",anon"`
+	Rest        []stage  `sparse:",anon"`
+	Units       []stage  `sparse:"unit"`
+	Last        stage    `sparse:"unit"`
+	unexported  string
+}
+
+func TestUnmarshal(t *testing.T) {
+	const src = `depth gt
+depth lte
+no-collision!
+alpha true
+Skip ignored
+- ignored
+name shader
+data bytes
+size 0x10
+Scale 1.5
+tag a; tag b
+{ map first.tga }
+{ map second.tga; blend add }
+unit { map u1 }
+{ map third.tga }
+{ map fourth.tga }
+unit { map u2 }
+unexported ignored
+unknown ignored
+`
+	var got shaderDef
+	if err := sparse.Unmarshal([]byte(src), &got); err != nil {
+		t.Fatalf("Unmarshal = %v", err)
+	}
+	want := shaderDef{
+		Depth:       "lte",
+		NoCollision: true,
+		Alpha:       true,
+		Name:        "SHADER",
+		Data:        []byte("bytes"),
+		Size:        16,
+		Scale:       1.5,
+		Tags:        []string{"a", "b"},
+		First:       stage{Map: "first.tga"},
+		Second:      &stage{Map: "second.tga", Blend: "add"},
+		Rest:        []stage{{Map: "third.tga"}, {Map: "fourth.tga"}},
+		Units:       []stage{{Map: "u1"}, {Map: "u2"}},
+		Last:        stage{Map: "u2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// A slice tagged with both a key and anon collects the nodes with that name along with every anonymous node.
+	var named struct {
+		Stages []stage `sparse:"stage,anon"`
+	}
+	if err := sparse.Unmarshal([]byte("stage { map a }\n{ map b }\nother { map c }"), &named); err != nil {
+		t.Fatalf("Unmarshal = %v", err)
+	} else if want := []stage{{Map: "a"}, {Map: "b"}}; !reflect.DeepEqual(named.Stages, want) {
+		t.Errorf("Unmarshal = %+v; want %+v", named.Stages, want)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	type sized struct {
+		Size int `sparse:"size"`
+	}
+	type nested struct {
+		Units  []sized `sparse:"unit"`
+		Outer  struct{ Inner sized }
+		Values map[string]string `sparse:"values"`
+		Flag   bool              `sparse:"flag"`
+	}
+	cases := []struct {
+		src  string
+		path []string
+		key  string
+		err  error // the error wrapped, matched by errors.Is, or nil to only check its type
+	}{
+		{"unit { size x }", []string{"unit"}, "size", strconv.ErrSyntax},
+		{"unit { size 1 }\nunit { size 99999999999999999999 }", []string{"unit"}, "size", strconv.ErrRange},
+		{"Outer { Inner { size 1.5 } }", []string{"Outer", "Inner"}, "size", strconv.ErrSyntax},
+		{"values x", nil, "values", nil},
+		{"flag maybe", nil, "flag", strconv.ErrSyntax},
+	}
+	for _, c := range cases {
+		var v nested
+		err := sparse.Unmarshal([]byte(c.src), &v)
+		var uerr *sparse.UnmarshalError
+		if !errors.As(err, &uerr) {
+			t.Errorf("Unmarshal(%q) = %v; want an *UnmarshalError", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(uerr.Path, c.path) || uerr.Key != c.key {
+			t.Errorf("Unmarshal(%q) error at %q, key %q; want %q, key %q", c.src, uerr.Path, uerr.Key, c.path, c.key)
+		}
+		if c.err != nil && !errors.Is(err, c.err) {
+			t.Errorf("Unmarshal(%q) = %v; want %v", c.src, err, c.err)
+		}
+	}
+
+	var s sized
+	var n int
+	for _, v := range []interface{}{nil, s, (*sized)(nil), &n} {
+		if err := sparse.Unmarshal([]byte("size 1"), v); err != sparse.ErrInvalidUnmarshal {
+			t.Errorf("Unmarshal(%T) = %v; want %v", v, err, sparse.ErrInvalidUnmarshal)
+		}
+	}
+	if err := sparse.Unmarshal([]byte("}"), &s); !errors.Is(err, sparse.ErrUnexpectedNodeLeave) {
+		t.Errorf("Unmarshal = %v; want %v", err, sparse.ErrUnexpectedNodeLeave)
+	}
+}
+
+func TestUnmarshalMap(t *testing.T) {
+	got, err := sparse.UnmarshalMap([]byte("a 1\na 2\nflag!\nn { x 1 }\nn { x 2 }\nm { }\nmix 1\nmix { y 2 }"))
+	if err != nil {
+		t.Fatalf("UnmarshalMap = %v", err)
+	}
+	want := map[string]interface{}{
+		"a":    []string{"1", "2"},
+		"flag": "",
+		"n":    []map[string]interface{}{{"x": "1"}, {"x": "2"}},
+		"m":    map[string]interface{}{},
+		"mix":  []interface{}{"1", map[string]interface{}{"y": "2"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UnmarshalMap = %v; want %v", got, want)
+	}
+}
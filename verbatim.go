@@ -0,0 +1,70 @@
+package sparse
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrUnclosedBlock is returned, as a *ParseError, when the input ends within a verbatim block read with VerbatimBlocks.
+var ErrUnclosedBlock = errors.New("sparse: unclosed verbatim block")
+
+// readBlockStart returns a parser that reads the value of key as a verbatim block if the '{' last read is followed by
+// another, and otherwise enters the node named by key.
+func (p *Parser) readBlockStart(key string) parser {
+	open := p.last
+	var read parser
+	read = readFn(func(r Reader) (parser, Piece, error) {
+		c, n, err := p.readRune(r)
+		if err == ErrWouldBlock {
+			return read, nil, err
+		} else if err == nil && c == '{' {
+			return p.readBlock(key, open), nil, nil
+		}
+
+		if err != nil {
+			p.unread = append(p.unread, unread{err: err})
+		} else {
+			p.unreadRune(c, n)
+		}
+		return p.enter(key)
+	})
+	return read
+}
+
+// readBlock returns a parser that reads the value of key held between the "{{" at open and the "}}" closing it. Braces
+// within the block must be balanced for a "}}" to close it early.
+func (p *Parser) readBlock(key string, open Position) parser {
+	depth := 0
+	var closing bool // whether the last rune read was a '}' that may begin the "}}"
+	var read parser
+	read = readFn(func(r Reader) (parser, Piece, error) {
+		c, _, err := p.readRune(r)
+		for err == nil {
+			if closing && c == '}' {
+				value := p.buf.String()
+				p.buf.Reset()
+				return readFn(p.readKey), p.newField(key, value[:len(value)-1], 0), nil
+			}
+			closing = false
+			if c == '{' {
+				depth++
+			} else if c == '}' && depth > 0 {
+				depth--
+			} else if c == '}' {
+				closing = true
+			}
+			p.buf.WriteRune(c)
+			c, _, err = p.readRune(r)
+		}
+
+		if err == ErrWouldBlock {
+			return read, nil, err
+		}
+		p.buf.Reset()
+		if err == io.EOF {
+			err = &ParseError{Pos: open, Err: ErrUnclosedBlock}
+		}
+		return errReader{err}, nil, err
+	})
+	return read
+}